@@ -1,30 +1,190 @@
 package main
 
 import (
+	"io"
 	"os"
-	"sort"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
 	"github.com/pishiko/tenmusu/internal/http"
+	"github.com/pishiko/tenmusu/internal/layout"
 	"github.com/pishiko/tenmusu/internal/parser/css"
 	"github.com/pishiko/tenmusu/internal/parser/html"
 	"github.com/pishiko/tenmusu/internal/parser/model"
+	"github.com/pishiko/tenmusu/internal/parser/xml"
 	"github.com/pishiko/tenmusu/internal/window"
 )
 
 type Browser struct {
+	window     *window.Window
+	node       *model.Node
+	rules      []css.CSSRule
+	history    map[string]bool // URLs of the documents loaded so far, for :visited
+	media      css.Media       // environment @media rules are evaluated against
+	navigation int             // incremented by each navigation, so that only the latest is shown
+
+	fonts   map[string]*text.GoTextFaceSource // web fonts by URL, shared with the loads in the background
+	fontsMu sync.Mutex
+
+	url        *http.URL // URL of the current document
+	base       *http.URL // base URL of the current document, from <base href>
+	baseTarget string    // default browsing context of links, from <base target>
+}
+
+// page is a document loaded with its stylesheets and web fonts, before
+// it is styled and shown.
+type page struct {
+	url        *http.URL
+	base       *http.URL
+	baseTarget string
+	node       *model.Node
+	rules      []css.CSSRule
+	fonts      []layout.FontFace
 }
 
 func NewBrowser() *Browser {
-	return &Browser{}
+	return &Browser{
+		history: map[string]bool{},
+		fonts:   map[string]*text.GoTextFaceSource{},
+		media: css.Media{
+			Type:        "screen",
+			Width:       window.DefaultWidth,
+			Height:      window.DefaultHeight,
+			ColorScheme: "light",
+		},
+	}
 }
+
 func (b *Browser) Load(url string) {
 	docUrl := http.NewURL(url)
 	if docUrl == nil {
 		println("Invalid URL")
 		return
 	}
+	p := b.load(docUrl, b.media)
+	if p == nil {
+		return
+	}
 
-	response := docUrl.Request()
+	b.window = window.NewWindow(p.node)
+	b.window.Navigate = b.navigate
+	b.window.FollowLink = b.followLink
+	b.window.Restyle = b.restyle
+	b.window.Resize = b.resize
+	b.show(p)
+	window.Open(b.window)
+}
+
+// navigate replaces the document in the window with the one at url,
+// resolved against the base URL of the current document. The document
+// is loaded in the background, and the current one stays until it is ready.
+func (b *Browser) navigate(url string) {
+	docUrl := b.base.Resolve(url)
+	if docUrl == nil {
+		println("Invalid URL:", url)
+		return
+	}
+	b.navigation++
+	navigation, media := b.navigation, b.media
+	go func() {
+		p := b.load(docUrl, media)
+		if p == nil {
+			return
+		}
+		b.window.RunOnUpdate(func() {
+			if navigation == b.navigation {
+				b.show(p)
+			}
+		})
+	}()
+}
+
+// followLink navigates to the href of an activated link, in the browsing
+// context its target or the <base target> names. There is one window per
+// process, so links to other browsing contexts open a new process.
+// https://html.spec.whatwg.org/multipage/document-sequences.html#the-rules-for-choosing-a-navigable
+func (b *Browser) followLink(link *model.Node) {
+	href, ok := link.GetAttribute("href")
+	if !ok {
+		return
+	}
+	target, ok := link.GetAttribute("target")
+	if !ok {
+		target = b.baseTarget
+	}
+	switch strings.ToLower(target) {
+	case "", "_self", "_parent", "_top":
+		b.navigate(href)
+		return
+	}
+	docUrl := b.base.Resolve(href)
+	if docUrl == nil {
+		println("Invalid URL:", href)
+		return
+	}
+	if err := exec.Command(os.Args[0], docUrl.String()).Start(); err != nil {
+		println("Failed to open a new window:", err.Error())
+	}
+}
+
+// show styles the loaded page and makes it the document of the window.
+func (b *Browser) show(p *page) {
+	b.url = p.url
+	b.base, b.baseTarget = p.base, p.baseTarget
+	b.history[p.url.String()] = true
+	b.markVisited(p.node)
+
+	registerFonts(p.fonts)
+	css.ApplyStyle(p.node, p.rules, b.media)
+	b.node = p.node
+	b.rules = p.rules
+
+	b.window.SetDocument(p.node)
+	b.scheduleRefresh(p.node)
+	// printDebug(p.node, 0)
+}
+
+// load fetches the document at docUrl with its stylesheets and the web
+// fonts used in media. It does not touch the current document, so that
+// it can run in the background.
+func (b *Browser) load(docUrl *http.URL, media css.Media) *page {
+	url := docUrl.String()
+	parser := html.NewParser()
+	parser.File = url
+	// stylesheets are fetched as soon as their <link> is parsed, while the rest of the document arrives
+	sheets := []*linkedSheet{}
+	linkBase, foundBase := docUrl, false
+	parser.OnElement = func(node *model.Node) {
+		switch node.Value {
+		case "base":
+			if href, ok := node.GetAttribute("href"); ok && !foundBase {
+				foundBase = true
+				if u := docUrl.Resolve(strings.TrimSpace(href)); u != nil {
+					linkBase = u
+				}
+			}
+		case "link":
+			if isStylesheetLink(node) {
+				sheets = append(sheets, fetchStylesheet(linkBase, node))
+			}
+		}
+	}
+	xmlBody := &strings.Builder{}
+	response, err := docUrl.RequestFunc(func(headers map[string]string) io.Writer {
+		if xml.IsXMLType(headers["content-type"]) {
+			return xmlBody
+		}
+		return parser
+	})
+	if err != nil {
+		println("Failed to fetch:", url, err.Error())
+		return nil
+	}
 	println("\nStatus line:")
 	println(response.Version + " " + response.Status + " " + response.Explanation)
 	println("\nResponse headers:")
@@ -32,37 +192,301 @@ func (b *Browser) Load(url string) {
 		println(key + ": " + value)
 	}
 
-	node := html.Parse(response.Body)
+	var node *model.Node
+	if xml.IsXMLType(response.Headers["content-type"]) {
+		var diagnostics []model.Diagnostic
+		node, diagnostics = xml.Parse(xmlBody.String(), url)
+		printDiagnostics(diagnostics)
+	} else {
+		node = parser.Close()
+		printDiagnostics(parser.Diagnostics())
+	}
+
+	base, baseTarget := documentBase(node, docUrl)
 
 	// css
-	cssLinks := afterParse(node)
+	if len(sheets) == 0 {
+		// XML documents are parsed after they are received
+		for _, link := range afterParse(node) {
+			sheets = append(sheets, fetchStylesheet(base, link))
+		}
+	}
 	// browser.css
 	cssContent, err := os.ReadFile("browser.css")
 	if err != nil {
 		println("Error reading browser.css:", err)
-		return
+		return nil
+	}
+	rules, diagnostics := css.CSSParseFileWithImports("browser.css", string(cssContent), css.UserAgentOrigin, importer)
+	printDiagnostics(diagnostics)
+	// user.css
+	if userContent, err := os.ReadFile("user.css"); err == nil {
+		sheet, diagnostics := css.CSSParseFileWithImports("user.css", string(userContent), css.UserOrigin, importer)
+		printDiagnostics(diagnostics)
+		rules = append(rules, sheet...)
 	}
-	rules := css.CSSParse(string(cssContent))
 	// cssLinks
-	for _, link := range cssLinks {
-		cssUrl := docUrl.Resolve(link)
-		println("Fetching CSS from:", cssUrl.Scheme+"://"+cssUrl.Host+cssUrl.Path)
-		println("link:", link)
-		response := cssUrl.Request()
-		if response == nil {
-			println("Failed to fetch CSS from:", link)
+	for _, sheet := range sheets {
+		<-sheet.done
+		printDiagnostics(sheet.diagnostics)
+		rules = append(rules, sheet.rules...)
+	}
+
+	return &page{
+		url:        docUrl,
+		base:       base,
+		baseTarget: baseTarget,
+		node:       node,
+		rules:      rules,
+		fonts:      b.loadFonts(rules, media),
+	}
+}
+
+// linkedSheet is a stylesheet of a <link> element being fetched in the background.
+type linkedSheet struct {
+	done        chan struct{}
+	rules       []css.CSSRule
+	diagnostics []model.Diagnostic
+}
+
+// fetchStylesheet starts fetching the stylesheet of link, whose href is
+// resolved against base. Its rules only apply in the media of link.
+func fetchStylesheet(base *http.URL, link *model.Node) *linkedSheet {
+	sheet := &linkedSheet{done: make(chan struct{})}
+	href, _ := link.GetAttribute("href")
+	media, _ := link.GetAttribute("media")
+	go func() {
+		defer close(sheet.done)
+		cssUrl := base.Resolve(href)
+		if cssUrl == nil {
+			println("Invalid CSS URL:", href)
+			return
+		}
+		println("Fetching CSS from:", cssUrl.String())
+		response, err := cssUrl.Request()
+		if err != nil {
+			println("Failed to fetch CSS from:", href, err.Error())
+			return
+		}
+		sheet.rules, sheet.diagnostics = css.CSSParseFileWithImports(cssUrl.String(), response.Body, css.AuthorOrigin, importer)
+		sheet.rules = css.WithMedia(sheet.rules, css.ParseMediaQueryList(media))
+	}()
+	return sheet
+}
+
+// restyle recomputes the styles of the current document, after the state of its elements changed.
+func (b *Browser) restyle() {
+	css.ApplyStyle(b.node, b.rules, b.media)
+}
+
+// resize updates the viewport of media queries, and recomputes the styles
+// when the new size crosses a breakpoint, or when some lengths are in
+// viewport units.
+func (b *Browser) resize(width, height int) {
+	media := b.media
+	media.Width, media.Height = float64(width), float64(height)
+	changed := css.MediaChanged(b.rules, b.media, media)
+	b.media = media
+	if changed {
+		// @font-face rules may be inside the @media rules too
+		registerFonts(b.loadFonts(b.rules, b.media))
+		b.restyle()
+	} else if css.ViewportRelative(b.node) {
+		b.restyle()
+	}
+}
+
+// importer loads the sheets imported by stylesheets.
+var importer = &css.ImportLoader{Resolve: resolve, Load: fetch}
+
+// resolve resolves url referred to from the stylesheet at file, like an
+// @import or a web font. Sheets read from the working directory, like
+// browser.css, refer to local files.
+func resolve(file, url string) (string, bool) {
+	base := http.NewURL(file)
+	if base == nil && !strings.Contains(url, "://") {
+		return filepath.Join(filepath.Dir(file), url), true
+	}
+	var resolved *http.URL
+	if base == nil {
+		resolved = http.NewURL(url)
+	} else {
+		resolved = base.Resolve(url)
+	}
+	if resolved == nil {
+		return "", false
+	}
+	return resolved.String(), true
+}
+
+// fetch fetches the contents at a location returned by resolve.
+func fetch(location string) (string, bool) {
+	u := http.NewURL(location)
+	if u == nil {
+		content, err := os.ReadFile(location)
+		if err != nil {
+			return "", false
+		}
+		return string(content), true
+	}
+	println("Fetching from:", location)
+	response, err := u.Request()
+	if err != nil {
+		println("Failed to fetch:", location, err.Error())
+		return "", false
+	}
+	return response.Body, true
+}
+
+// loadFonts loads the web fonts of the @font-face rules applying in
+// media. Each face uses the first of its sources that can be loaded.
+func (b *Browser) loadFonts(rules []css.CSSRule, media css.Media) []layout.FontFace {
+	ret := []layout.FontFace{}
+	for _, face := range css.FontFaces(rules, media) {
+		for _, src := range face.Sources {
+			if src.URL == "" || !supportedFontFormats[src.Format] {
+				continue
+			}
+			url, ok := resolve(face.Pos.File, src.URL)
+			if !ok {
+				println("Invalid font URL:", src.URL)
+				continue
+			}
+			b.fontsMu.Lock()
+			source, ok := b.fonts[url]
+			b.fontsMu.Unlock()
+			if !ok {
+				body, ok := fetch(url)
+				if !ok {
+					println("Failed to fetch font:", src.URL)
+					continue
+				}
+				var err error
+				source, err = layout.NewFontFaceSource([]byte(body))
+				if err != nil {
+					println("Failed to load font:", url, err.Error())
+					continue
+				}
+				b.fontsMu.Lock()
+				b.fonts[url] = source
+				b.fontsMu.Unlock()
+			}
+			ret = append(ret, layout.FontFace{FontFace: face, Source: source})
+			break
+		}
+	}
+	return ret
+}
+
+// registerFonts replaces the web fonts of the previous document with faces.
+func registerFonts(faces []layout.FontFace) {
+	layout.ClearFontFaces()
+	for _, face := range faces {
+		layout.RegisterFontFace(face)
+	}
+}
+
+// supportedFontFormats are the values of format() in src that can be
+// loaded, with the empty string for sources without a format.
+var supportedFontFormats = map[string]bool{
+	"":         true,
+	"truetype": true,
+	"opentype": true,
+	"woff":     true,
+	"woff2":    true,
+}
+
+// markVisited sets the visited state of links to documents in the history.
+func (b *Browser) markVisited(node *model.Node) {
+	for _, tag := range []string{"a", "area"} {
+		for _, link := range node.GetElementsByTagName(tag) {
+			href, ok := link.GetAttribute("href")
+			if !ok {
+				continue
+			}
+			if u := b.base.Resolve(href); u != nil && b.history[u.String()] {
+				link.State |= model.StateVisited
+			}
+		}
+	}
+}
+
+// documentBase returns the base URL and the base target of the document.
+// Only the first <base> element with each attribute counts.
+func documentBase(node *model.Node, docUrl *http.URL) (*http.URL, string) {
+	base := docUrl
+	target := ""
+	foundHref, foundTarget := false, false
+	for _, elem := range node.GetElementsByTagName("base") {
+		if href, ok := elem.GetAttribute("href"); ok && !foundHref {
+			foundHref = true
+			if u := docUrl.Resolve(strings.TrimSpace(href)); u != nil {
+				base = u
+			}
+		}
+		if t, ok := elem.GetAttribute("target"); ok && !foundTarget {
+			foundTarget = true
+			target = t
+		}
+	}
+	return base, target
+}
+
+// scheduleRefresh starts the timer of <meta http-equiv="refresh"> if the document has one.
+func (b *Browser) scheduleRefresh(node *model.Node) {
+	for _, meta := range node.GetElementsByTagName("meta") {
+		equiv, _ := meta.GetAttribute("http-equiv")
+		if !strings.EqualFold(equiv, "refresh") {
+			continue
+		}
+		content, _ := meta.GetAttribute("content")
+		delay, url, ok := parseRefresh(content)
+		if !ok {
 			continue
 		}
-		rules = append(rules, css.CSSParse(response.Body)...)
+		if url == "" {
+			url = b.url.String()
+		}
+		println("Refresh to", url, "after", delay.String())
+		b.window.ScheduleRefresh(delay, url)
+		return
 	}
+}
 
-	sort.Slice(rules, func(i, j int) bool {
-		return rules[i].Selector.Priority() > rules[j].Selector.Priority()
-	})
-	css.ApplyStyle(node, rules)
+// parseRefresh parses the content attribute of a refresh pragma, like "5; url=/next.html".
+// https://html.spec.whatwg.org/multipage/semantics.html#shared-declarative-refresh-steps
+func parseRefresh(content string) (time.Duration, string, bool) {
+	content = strings.TrimSpace(content)
+	i := 0
+	for i < len(content) && (content[i] >= '0' && content[i] <= '9' || content[i] == '.') {
+		i++
+	}
+	if i == 0 {
+		return 0, "", false
+	}
+	seconds, err := strconv.ParseFloat(strings.TrimRight(content[:i], "."), 64)
+	if err != nil {
+		return 0, "", false
+	}
+	delay := time.Duration(seconds * float64(time.Second))
 
-	// printDebug(node, 0)
-	window.Open(node)
+	rest := strings.TrimLeft(content[i:], " \t\n")
+	rest = strings.TrimLeft(rest, ";,")
+	rest = strings.TrimLeft(rest, " \t\n")
+	if len(rest) >= 3 && strings.EqualFold(rest[:3], "url") {
+		after := strings.TrimLeft(rest[3:], " \t\n")
+		if strings.HasPrefix(after, "=") {
+			rest = strings.TrimLeft(after[1:], " \t\n")
+		}
+	}
+	if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+		quote := rest[0]
+		rest = rest[1:]
+		if end := strings.IndexByte(rest, quote); end >= 0 {
+			rest = rest[:end]
+		}
+	}
+	return delay, strings.TrimSpace(rest), true
 }
 
 func main() {
@@ -76,6 +500,12 @@ func main() {
 	browser.Load(url)
 }
 
+func printDiagnostics(diagnostics []model.Diagnostic) {
+	for _, d := range diagnostics {
+		println(d.String())
+	}
+}
+
 func printDebug(node *model.Node, indent int) {
 	for i := 0; i < indent; i++ {
 		print("  ")
@@ -83,6 +513,16 @@ func printDebug(node *model.Node, indent int) {
 	switch node.Type {
 	case model.Text:
 		println(node.Value)
+	case model.Comment:
+		println("<!--" + node.Value + "-->")
+	case model.Doctype:
+		println("<!DOCTYPE " + node.Value + ">")
+	case model.ProcessingInstruction:
+		println("<?" + node.Value + "?>")
+	case model.Document:
+		for _, node := range node.Children {
+			printDebug(node, indent)
+		}
 	case model.Element:
 		println("<" + node.Value + ">")
 		for _, node := range node.Children {
@@ -95,27 +535,23 @@ func printDebug(node *model.Node, indent int) {
 	}
 }
 
-type AfterParser struct {
-	cssLinks []string
-}
-
-func (p *AfterParser) recursive(node *model.Node) {
-	if node.Type == model.Element && node.Value == "link" {
-		if rel, ok := node.Attrs["rel"]; ok && rel == "stylesheet" {
-			if href, ok := node.Attrs["href"]; ok {
-				p.cssLinks = append(p.cssLinks, href)
-			}
+func afterParse(node *model.Node) []*model.Node {
+	cssLinks := []*model.Node{}
+	for _, link := range node.GetElementsByTagName("link") {
+		if isStylesheetLink(link) {
+			cssLinks = append(cssLinks, link)
 		}
 	}
-	for _, child := range node.Children {
-		p.recursive(child)
-	}
+	return cssLinks
 }
 
-func afterParse(node *model.Node) []string {
-	p := &AfterParser{
-		cssLinks: []string{},
+// isStylesheetLink reports whether link is a <link rel="stylesheet"> element with an href.
+func isStylesheetLink(link *model.Node) bool {
+	if link.Value != "link" {
+		return false
+	}
+	if rel, ok := link.GetAttribute("rel"); !ok || rel != "stylesheet" {
+		return false
 	}
-	p.recursive(node)
-	return p.cssLinks
+	return link.HasAttribute("href")
 }
@@ -3,6 +3,7 @@ module github.com/pishiko/tenmusu
 go 1.24.5
 
 require (
+	github.com/andybalholm/brotli v1.2.0
 	github.com/hajimehoshi/ebiten/v2 v2.8.8
 	golang.org/x/text v0.18.0
 )
@@ -0,0 +1,136 @@
+// Package font decodes the font formats used by @font-face into plain
+// TrueType or OpenType data.
+package font
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+var (
+	ErrUnknownFormat = errors.New("font: unknown format")
+	ErrInvalid       = errors.New("font: invalid data")
+	ErrCollection    = errors.New("font: font collections are not supported")
+)
+
+const (
+	flavorTrueType = 0x00010000
+	flavorOpenType = 0x4f54544f // OTTO
+	flavorApple    = 0x74727565 // true
+	flavorTTC      = 0x74746366 // ttcf
+	signatureWOFF  = 0x774f4646 // wOFF
+	signatureWOFF2 = 0x774f4632 // wOF2
+)
+
+// Decode returns the sfnt data of a TTF, OTF, WOFF or WOFF2 font.
+// TTF and OTF data is returned as is.
+func Decode(data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, ErrUnknownFormat
+	}
+	switch binary.BigEndian.Uint32(data) {
+	case flavorTrueType, flavorOpenType, flavorApple:
+		return data, nil
+	case flavorTTC:
+		return nil, ErrCollection
+	case signatureWOFF:
+		return decodeWOFF(data)
+	case signatureWOFF2:
+		return decodeWOFF2(data)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// table is a font table before it is written into an sfnt file.
+type table struct {
+	tag  uint32
+	data []byte
+}
+
+// buildSFNT writes tables into an sfnt file with the given flavor.
+// https://learn.microsoft.com/en-us/typography/opentype/spec/otff#table-directory
+func buildSFNT(flavor uint32, tables []table) []byte {
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].tag < tables[j].tag
+	})
+	n := len(tables)
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= n {
+		entrySelector++
+	}
+	searchRange := (1 << entrySelector) * 16
+
+	size := 12 + 16*n
+	for _, t := range tables {
+		size += pad4(len(t.data))
+	}
+	out := make([]byte, 12+16*n, size)
+	binary.BigEndian.PutUint32(out[0:], flavor)
+	binary.BigEndian.PutUint16(out[4:], uint16(n))
+	binary.BigEndian.PutUint16(out[6:], uint16(searchRange))
+	binary.BigEndian.PutUint16(out[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(out[10:], uint16(n*16-searchRange))
+	for i, t := range tables {
+		record := out[12+16*i:]
+		binary.BigEndian.PutUint32(record[0:], t.tag)
+		binary.BigEndian.PutUint32(record[4:], checksum(t.data))
+		binary.BigEndian.PutUint32(record[8:], uint32(len(out)))
+		binary.BigEndian.PutUint32(record[12:], uint32(len(t.data)))
+		out = append(out, t.data...)
+		out = append(out, make([]byte, pad4(len(t.data))-len(t.data))...)
+	}
+	return out
+}
+
+func checksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}
+
+// reader reads big-endian values, remembering the first read past the end.
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || r.pos+n > len(r.data) {
+		r.err = ErrInvalid
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *reader) u8() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) u16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) u32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
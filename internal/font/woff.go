@@ -0,0 +1,55 @@
+package font
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+)
+
+// decodeWOFF decodes WOFF 1.0, whose tables are compressed one by one with zlib.
+// https://www.w3.org/TR/WOFF/
+func decodeWOFF(data []byte) ([]byte, error) {
+	r := &reader{data: data}
+	r.u32() // signature
+	flavor := r.u32()
+	r.u32() // length
+	numTables := int(r.u16())
+	r.bytes(44 - r.pos) // rest of the header
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	tables := make([]table, 0, numTables)
+	for range numTables {
+		tag := r.u32()
+		offset := int(r.u32())
+		compLength := int(r.u32())
+		origLength := int(r.u32())
+		r.u32() // origChecksum
+		if r.err != nil {
+			return nil, r.err
+		}
+		if offset < 0 || compLength < 0 || offset+compLength > len(data) || compLength > origLength {
+			return nil, ErrInvalid
+		}
+		raw := data[offset : offset+compLength]
+		if compLength == origLength {
+			tables = append(tables, table{tag: tag, data: raw})
+			continue
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		decompressed, err := io.ReadAll(io.LimitReader(zr, int64(origLength)+1))
+		zr.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(decompressed) != origLength {
+			return nil, ErrInvalid
+		}
+		tables = append(tables, table{tag: tag, data: decompressed})
+	}
+	return buildSFNT(flavor, tables), nil
+}
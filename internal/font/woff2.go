@@ -0,0 +1,475 @@
+package font
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+// knownTags are the tags a WOFF2 table directory refers to by index.
+// https://www.w3.org/TR/WOFF2/#table_dir_format
+var knownTags = [63]string{
+	"cmap", "head", "hhea", "hmtx", "maxp", "name", "OS/2", "post",
+	"cvt ", "fpgm", "glyf", "loca", "prep", "CFF ", "VORG", "EBDT",
+	"EBLC", "gasp", "hdmx", "kern", "LTSH", "PCLT", "VDMX", "vhea",
+	"vmtx", "BASE", "GDEF", "GPOS", "GSUB", "EBSC", "JSTF", "MATH",
+	"CBDT", "CBLC", "COLR", "CPAL", "SVG ", "sbix", "acnt", "avar",
+	"bdat", "bloc", "bsln", "cvar", "fdsc", "feat", "fmtx", "fvar",
+	"gvar", "hsty", "just", "lcar", "mort", "morx", "opbd", "prop",
+	"trak", "Zapf", "Silf", "Glat", "Gloc", "Feat", "Sill",
+}
+
+func tagOf(s string) uint32 {
+	return binary.BigEndian.Uint32([]byte(s))
+}
+
+var (
+	tagGlyf = tagOf("glyf")
+	tagLoca = tagOf("loca")
+	tagHmtx = tagOf("hmtx")
+	tagHhea = tagOf("hhea")
+	tagMaxp = tagOf("maxp")
+)
+
+type woff2Table struct {
+	tag         uint32
+	transformed bool
+	length      int // length in the decompressed stream
+	data        []byte
+}
+
+// decodeWOFF2 decodes WOFF 2.0, whose tables are compressed together with
+// Brotli, and whose glyf, loca and hmtx tables may be transformed.
+// https://www.w3.org/TR/WOFF2/
+func decodeWOFF2(data []byte) ([]byte, error) {
+	r := &reader{data: data}
+	r.u32() // signature
+	flavor := r.u32()
+	r.u32() // length
+	numTables := int(r.u16())
+	r.u16() // reserved
+	r.u32() // totalSfntSize
+	compressedSize := int(r.u32())
+	r.bytes(48 - r.pos) // versions, metadata and private data
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	tables := make([]*woff2Table, numTables)
+	total := 0
+	for i := range tables {
+		flags := r.u8()
+		t := &woff2Table{}
+		if index := flags & 0x3f; index == 63 {
+			t.tag = r.u32()
+		} else {
+			t.tag = tagOf(knownTags[index])
+		}
+		version := flags >> 6
+		t.length = int(r.base128())
+		if t.tag == tagGlyf || t.tag == tagLoca {
+			t.transformed = version == 0
+		} else {
+			t.transformed = version != 0
+		}
+		if t.transformed {
+			t.length = int(r.base128())
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		total += t.length
+		tables[i] = t
+	}
+	if flavor == flavorTTC {
+		return nil, ErrCollection
+	}
+
+	compressed := r.bytes(compressedSize)
+	if r.err != nil {
+		return nil, r.err
+	}
+	stream, err := io.ReadAll(io.LimitReader(brotli.NewReader(bytes.NewReader(compressed)), int64(total)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(stream) != total {
+		return nil, ErrInvalid
+	}
+	byTag := map[uint32]*woff2Table{}
+	for _, t := range tables {
+		t.data, stream = stream[:t.length], stream[t.length:]
+		byTag[t.tag] = t
+	}
+
+	var xMins []int16
+	if glyf := byTag[tagGlyf]; glyf != nil && glyf.transformed {
+		loca := byTag[tagLoca]
+		if loca == nil {
+			return nil, ErrInvalid
+		}
+		glyf.data, loca.data, xMins, err = reconstructGlyf(glyf.data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if hmtx := byTag[tagHmtx]; hmtx != nil && hmtx.transformed {
+		hhea, maxp := byTag[tagHhea], byTag[tagMaxp]
+		if xMins == nil || hhea == nil || len(hhea.data) < 36 || maxp == nil || len(maxp.data) < 6 {
+			return nil, ErrInvalid
+		}
+		numHMetrics := int(binary.BigEndian.Uint16(hhea.data[34:]))
+		numGlyphs := int(binary.BigEndian.Uint16(maxp.data[4:]))
+		hmtx.data, err = reconstructHmtx(hmtx.data, numGlyphs, numHMetrics, xMins)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]table, len(tables))
+	for i, t := range tables {
+		out[i] = table{tag: t.tag, data: t.data}
+	}
+	return buildSFNT(flavor, out), nil
+}
+
+// reconstructGlyf rebuilds the glyf and loca tables from a transformed glyf
+// table, and also returns the xMin of each glyph for the hmtx transform.
+// https://www.w3.org/TR/WOFF2/#glyf_table_format
+func reconstructGlyf(data []byte) ([]byte, []byte, []int16, error) {
+	r := &reader{data: data}
+	r.u16() // reserved
+	optionFlags := r.u16()
+	numGlyphs := int(r.u16())
+	indexFormat := r.u16()
+	var sizes [7]int
+	for i := range sizes {
+		sizes[i] = int(r.u32())
+	}
+	var streams [7]*reader
+	for i, size := range sizes {
+		streams[i] = &reader{data: r.bytes(size)}
+	}
+	var overlap []byte
+	if optionFlags&1 != 0 {
+		overlap = r.bytes((numGlyphs + 7) / 8)
+	}
+	if r.err != nil {
+		return nil, nil, nil, r.err
+	}
+	nContourStream, nPointsStream, flagStream, glyphStream, compositeStream, bboxStream, instructionStream :=
+		streams[0], streams[1], streams[2], streams[3], streams[4], streams[5], streams[6]
+	bboxBitmap := bboxStream.bytes(4 * ((numGlyphs + 31) / 32))
+	if bboxStream.err != nil {
+		return nil, nil, nil, bboxStream.err
+	}
+
+	glyf := []byte{}
+	offsets := make([]int, numGlyphs+1)
+	xMins := make([]int16, numGlyphs)
+	for i := range numGlyphs {
+		offsets[i] = len(glyf)
+		nContours := int16(nContourStream.u16())
+		hasBBox := bboxBitmap[i>>3]&(0x80>>(i&7)) != 0
+		var glyph []byte
+		switch {
+		case nContours == 0:
+			if hasBBox {
+				return nil, nil, nil, ErrInvalid
+			}
+		case nContours == -1:
+			if !hasBBox {
+				return nil, nil, nil, ErrInvalid
+			}
+			glyph = compositeGlyph(compositeStream, glyphStream, instructionStream, bboxStream.bytes(8))
+		case nContours > 0:
+			var bbox []byte
+			if hasBBox {
+				bbox = bboxStream.bytes(8)
+			}
+			overlaps := overlap != nil && overlap[i>>3]&(0x80>>(i&7)) != 0
+			glyph = simpleGlyph(int(nContours), nPointsStream, flagStream, glyphStream, instructionStream, bbox, overlaps)
+		default:
+			return nil, nil, nil, ErrInvalid
+		}
+		for _, s := range streams {
+			if s.err != nil {
+				return nil, nil, nil, s.err
+			}
+		}
+		if len(glyph) >= 10 {
+			xMins[i] = int16(binary.BigEndian.Uint16(glyph[2:]))
+		}
+		glyf = append(glyf, glyph...)
+		glyf = append(glyf, make([]byte, pad4(len(glyph))-len(glyph))...)
+	}
+	offsets[numGlyphs] = len(glyf)
+
+	loca := []byte{}
+	for _, offset := range offsets {
+		if indexFormat == 0 {
+			loca = binary.BigEndian.AppendUint16(loca, uint16(offset/2))
+		} else {
+			loca = binary.BigEndian.AppendUint32(loca, uint32(offset))
+		}
+	}
+	return glyf, loca, xMins, nil
+}
+
+func compositeGlyph(composite, glyphStream, instructions *reader, bbox []byte) []byte {
+	out := binary.BigEndian.AppendUint16(nil, 0xffff)
+	out = append(out, bbox...)
+	start := composite.pos
+	haveInstructions := false
+	for {
+		flags := composite.u16()
+		haveInstructions = haveInstructions || flags&0x0100 != 0
+		n := 2 + 2 // glyphIndex and byte arguments
+		if flags&0x0001 != 0 {
+			n += 2 // word arguments
+		}
+		switch {
+		case flags&0x0008 != 0:
+			n += 2
+		case flags&0x0040 != 0:
+			n += 4
+		case flags&0x0080 != 0:
+			n += 8
+		}
+		composite.bytes(n)
+		if composite.err != nil || flags&0x0020 == 0 {
+			break
+		}
+	}
+	if composite.err != nil {
+		return nil
+	}
+	out = append(out, composite.data[start:composite.pos]...)
+	if haveInstructions {
+		length := glyphStream.u255()
+		out = binary.BigEndian.AppendUint16(out, uint16(length))
+		out = append(out, instructions.bytes(length)...)
+	}
+	return out
+}
+
+type point struct {
+	dx, dy  int
+	onCurve bool
+}
+
+func simpleGlyph(nContours int, nPointsStream, flagStream, glyphStream, instructions *reader, bbox []byte, overlaps bool) []byte {
+	endPts := make([]int, nContours)
+	total := 0
+	for i := range endPts {
+		total += nPointsStream.u255()
+		endPts[i] = total - 1
+	}
+	if nPointsStream.err != nil || total > 0xffff {
+		return nil
+	}
+
+	points := make([]point, total)
+	x, y := 0, 0
+	xMin, yMin, xMax, yMax := 0, 0, 0, 0
+	for i := range points {
+		flag := flagStream.u8()
+		points[i] = decodeTriplet(flag, glyphStream)
+		x += points[i].dx
+		y += points[i].dy
+		if i == 0 {
+			xMin, yMin, xMax, yMax = x, y, x, y
+		}
+		xMin, yMin, xMax, yMax = min(xMin, x), min(yMin, y), max(xMax, x), max(yMax, y)
+	}
+	instructionLength := glyphStream.u255()
+	if flagStream.err != nil || glyphStream.err != nil {
+		return nil
+	}
+
+	out := binary.BigEndian.AppendUint16(nil, uint16(nContours))
+	if bbox != nil {
+		out = append(out, bbox...)
+	} else {
+		for _, v := range []int{xMin, yMin, xMax, yMax} {
+			out = binary.BigEndian.AppendUint16(out, uint16(int16(v)))
+		}
+	}
+	for _, end := range endPts {
+		out = binary.BigEndian.AppendUint16(out, uint16(end))
+	}
+	out = binary.BigEndian.AppendUint16(out, uint16(instructionLength))
+	out = append(out, instructions.bytes(instructionLength)...)
+
+	flags := make([]byte, 0, total)
+	xs, ys := []byte{}, []byte{}
+	for i, p := range points {
+		var flag byte
+		if p.onCurve {
+			flag |= 0x01
+		}
+		if i == 0 && overlaps {
+			flag |= 0x40
+		}
+		flag, xs = encodeDelta(flag, xs, p.dx, 0x02, 0x10)
+		flag, ys = encodeDelta(flag, ys, p.dy, 0x04, 0x20)
+		flags = append(flags, flag)
+	}
+	out = append(out, flags...)
+	out = append(out, xs...)
+	return append(out, ys...)
+}
+
+// encodeDelta appends a coordinate delta of a simple glyph, using the
+// one byte form when it fits.
+func encodeDelta(flag byte, out []byte, d int, short, same byte) (byte, []byte) {
+	switch {
+	case d == 0:
+		flag |= same
+	case d > -256 && d < 256:
+		flag |= short
+		if d > 0 {
+			flag |= same
+		} else {
+			d = -d
+		}
+		out = append(out, byte(d))
+	default:
+		out = binary.BigEndian.AppendUint16(out, uint16(int16(d)))
+	}
+	return flag, out
+}
+
+// decodeTriplet decodes a point from its flag and the bytes following in glyphStream.
+// https://www.w3.org/TR/WOFF2/#triplet_decoding
+func decodeTriplet(flag byte, glyphStream *reader) point {
+	p := point{onCurve: flag&0x80 == 0}
+	flag &= 0x7f
+	withSign := func(flag byte, v int) int {
+		if flag&1 != 0 {
+			return v
+		}
+		return -v
+	}
+	switch {
+	case flag < 10:
+		in := glyphStream.bytes(1)
+		if in == nil {
+			return p
+		}
+		p.dy = withSign(flag, int(flag&14)<<7+int(in[0]))
+	case flag < 20:
+		in := glyphStream.bytes(1)
+		if in == nil {
+			return p
+		}
+		p.dx = withSign(flag, int((flag-10)&14)<<7+int(in[0]))
+	case flag < 84:
+		in := glyphStream.bytes(1)
+		if in == nil {
+			return p
+		}
+		b0 := int(flag - 20)
+		p.dx = withSign(flag, 1+(b0&0x30)+int(in[0]>>4))
+		p.dy = withSign(flag>>1, 1+(b0&0x0c)<<2+int(in[0]&0x0f))
+	case flag < 120:
+		in := glyphStream.bytes(2)
+		if in == nil {
+			return p
+		}
+		b0 := int(flag - 84)
+		p.dx = withSign(flag, 1+(b0/12)<<8+int(in[0]))
+		p.dy = withSign(flag>>1, 1+((b0%12)>>2)<<8+int(in[1]))
+	case flag < 124:
+		in := glyphStream.bytes(3)
+		if in == nil {
+			return p
+		}
+		p.dx = withSign(flag, int(in[0])<<4+int(in[1]>>4))
+		p.dy = withSign(flag>>1, int(in[1]&0x0f)<<8+int(in[2]))
+	default:
+		in := glyphStream.bytes(4)
+		if in == nil {
+			return p
+		}
+		p.dx = withSign(flag, int(in[0])<<8+int(in[1]))
+		p.dy = withSign(flag>>1, int(in[2])<<8+int(in[3]))
+	}
+	return p
+}
+
+// reconstructHmtx rebuilds the hmtx table, taking the left side bearings
+// left out by the transform from the xMin of the glyphs.
+// https://www.w3.org/TR/WOFF2/#hmtx_table_format
+func reconstructHmtx(data []byte, numGlyphs, numHMetrics int, xMins []int16) ([]byte, error) {
+	if numHMetrics < 1 || numHMetrics > numGlyphs || numGlyphs > len(xMins) {
+		return nil, ErrInvalid
+	}
+	r := &reader{data: data}
+	flags := r.u8()
+	advances := make([]uint16, numHMetrics)
+	for i := range advances {
+		advances[i] = r.u16()
+	}
+	lsbs := make([]int16, numGlyphs)
+	for i := range lsbs {
+		absent := flags&0x01 != 0
+		if i >= numHMetrics {
+			absent = flags&0x02 != 0
+		}
+		if absent {
+			lsbs[i] = xMins[i]
+		} else {
+			lsbs[i] = int16(r.u16())
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	out := []byte{}
+	for i, lsb := range lsbs {
+		if i < numHMetrics {
+			out = binary.BigEndian.AppendUint16(out, advances[i])
+		}
+		out = binary.BigEndian.AppendUint16(out, uint16(lsb))
+	}
+	return out, nil
+}
+
+// base128 reads a UIntBase128.
+func (r *reader) base128() uint32 {
+	var v uint32
+	for i := range 5 {
+		b := r.u8()
+		if r.err != nil {
+			return 0
+		}
+		if i == 0 && b == 0x80 || v&0xfe000000 != 0 {
+			r.err = ErrInvalid
+			return 0
+		}
+		v = v<<7 | uint32(b&0x7f)
+		if b&0x80 == 0 {
+			return v
+		}
+	}
+	r.err = ErrInvalid
+	return 0
+}
+
+// u255 reads a 255UInt16.
+func (r *reader) u255() int {
+	switch code := r.u8(); code {
+	case 253:
+		return int(r.u16())
+	case 254:
+		return int(r.u8()) + 253*2
+	case 255:
+		return int(r.u8()) + 253
+	default:
+		return int(code)
+	}
+}
@@ -0,0 +1,179 @@
+package font
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// sfntTables returns the tables of sfnt data by tag.
+func sfntTables(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	r := &reader{data: data}
+	r.u32()
+	n := int(r.u16())
+	r.bytes(6)
+	tables := map[string][]byte{}
+	for i := 0; i < n; i++ {
+		tag := string(r.bytes(4))
+		r.u32()
+		offset, length := int(r.u32()), int(r.u32())
+		if offset+length > len(data) {
+			t.Fatalf("table %q is out of bounds", tag)
+		}
+		tables[tag] = data[offset : offset+length]
+	}
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	return tables
+}
+
+// glyph is a glyph of the glyf table, decoded enough to compare outlines
+// whose encoding differs.
+type glyph struct {
+	bbox         []byte
+	ends         []uint16
+	points       [][3]int // x, y and whether the point is on the curve
+	instructions []byte
+	composite    []byte // components and instructions of a composite glyph, as is
+}
+
+// glyphs decodes the glyphs of the glyf table through the loca table.
+func glyphs(t *testing.T, tables map[string][]byte) []glyph {
+	t.Helper()
+	numGlyphs := int(binary.BigEndian.Uint16(tables["maxp"][4:]))
+	longLoca := binary.BigEndian.Uint16(tables["head"][50:]) == 1
+	loca, glyf := tables["loca"], tables["glyf"]
+	offset := func(i int) int {
+		if longLoca {
+			return int(binary.BigEndian.Uint32(loca[4*i:]))
+		}
+		return 2 * int(binary.BigEndian.Uint16(loca[2*i:]))
+	}
+	ret := []glyph{}
+	for i := 0; i < numGlyphs; i++ {
+		data := glyf[offset(i):offset(i+1)]
+		if len(data) == 0 {
+			ret = append(ret, glyph{})
+			continue
+		}
+		r := &reader{data: data}
+		contours := int(int16(r.u16()))
+		g := glyph{bbox: r.bytes(8)}
+		if contours < 0 {
+			g.composite = bytes.TrimRight(data[r.pos:], "\x00")
+			ret = append(ret, g)
+			continue
+		}
+		for c := 0; c < contours; c++ {
+			g.ends = append(g.ends, r.u16())
+		}
+		g.instructions = r.bytes(int(r.u16()))
+		n := 0
+		if contours > 0 {
+			n = int(g.ends[contours-1]) + 1
+		}
+		flags := []byte{}
+		for len(flags) < n && r.err == nil {
+			flag := r.u8()
+			flags = append(flags, flag)
+			if flag&8 != 0 {
+				for repeat := r.u8(); repeat > 0; repeat-- {
+					flags = append(flags, flag)
+				}
+			}
+		}
+		coordinate := func(flag, short, same byte) int {
+			switch {
+			case flag&short != 0 && flag&same != 0:
+				return int(r.u8())
+			case flag&short != 0:
+				return -int(r.u8())
+			case flag&same != 0:
+				return 0
+			}
+			return int(int16(r.u16()))
+		}
+		x, y := 0, 0
+		g.points = make([][3]int, n)
+		for j, flag := range flags {
+			x += coordinate(flag, 2, 0x10)
+			g.points[j][0] = x
+			g.points[j][2] = int(flag & 1)
+		}
+		for j, flag := range flags {
+			y += coordinate(flag, 4, 0x20)
+			g.points[j][1] = y
+		}
+		if r.err != nil {
+			t.Fatalf("glyph %d: %v", i, r.err)
+		}
+		ret = append(ret, g)
+	}
+	return ret
+}
+
+func TestDecodeWOFF2(t *testing.T) {
+	ttf, err := os.ReadFile("testdata/glyfTest.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	woff2, err := os.ReadFile("testdata/glyfTest.woff2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(woff2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, got := sfntTables(t, ttf), sfntTables(t, decoded)
+	if len(got) != len(want) {
+		t.Errorf("got %d tables, want %d", len(got), len(want))
+	}
+	for tag, data := range want {
+		switch tag {
+		case "glyf", "loca":
+			// reconstructed with an encoding of their own
+			continue
+		}
+		if !bytes.Equal(got[tag], data) {
+			t.Errorf("table %q differs from the TTF", tag)
+		}
+	}
+
+	wantGlyphs, gotGlyphs := glyphs(t, want), glyphs(t, got)
+	if len(gotGlyphs) != len(wantGlyphs) {
+		t.Fatalf("got %d glyphs, want %d", len(gotGlyphs), len(wantGlyphs))
+	}
+	simple, composites := 0, 0
+	for i := range wantGlyphs {
+		if wantGlyphs[i].composite != nil {
+			composites++
+		}
+		if len(wantGlyphs[i].points) > 0 {
+			simple++
+		}
+		if !reflect.DeepEqual(gotGlyphs[i], wantGlyphs[i]) {
+			t.Errorf("glyph %d is %+v, want %+v", i, gotGlyphs[i], wantGlyphs[i])
+		}
+	}
+	if simple == 0 || composites == 0 {
+		t.Errorf("the fixture has %d simple and %d composite glyphs", simple, composites)
+	}
+}
+
+func TestDecodeWOFF2Truncated(t *testing.T) {
+	woff2, err := os.ReadFile("testdata/glyfTest.woff2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{4, 20, 48, 60, len(woff2) / 2, len(woff2) - 1} {
+		if _, err := Decode(woff2[:n]); err == nil {
+			t.Errorf("decoding %d of %d bytes succeeded", n, len(woff2))
+		}
+	}
+}
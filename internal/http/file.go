@@ -2,25 +2,29 @@ package http
 
 import (
 	"io"
+	"mime"
 	"os"
+	"path/filepath"
 )
 
-func (u *URL) openFile() *Response {
+func (u *URL) openFile(body func(headers map[string]string) io.Writer) (*Response, error) {
 	// open local file
 	file, err := os.Open(u.Path)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	defer file.Close()
-	content, err := io.ReadAll(file)
-	if err != nil {
-		panic(err)
+	headers := map[string]string{}
+	if contentType := mime.TypeByExtension(filepath.Ext(u.Path)); contentType != "" {
+		headers["content-type"] = contentType
+	}
+	if _, err := io.Copy(body(headers), file); err != nil {
+		return nil, err
 	}
 	return &Response{
 		Status:      "",
 		Version:     "",
 		Explanation: "",
-		Headers:     map[string]string{},
-		Body:        string(content),
-	}
+		Headers:     headers,
+	}, nil
 }
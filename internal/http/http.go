@@ -3,6 +3,8 @@ package http
 import (
 	"bufio"
 	"crypto/tls"
+	"errors"
+	"io"
 	"net"
 	"strconv"
 	"strings"
@@ -56,6 +58,14 @@ func NewURL(url string) *URL {
 	return ret
 }
 
+func (u *URL) String() string {
+	s := u.Scheme + "://" + u.Host
+	if (u.Scheme == "http" && u.Port != 80) || (u.Scheme == "https" && u.Port != 443) {
+		s += ":" + strconv.Itoa(u.Port)
+	}
+	return s + u.Path
+}
+
 func (u *URL) Resolve(url string) *URL {
 	if strings.Contains(url, "://") {
 		return NewURL(url)
@@ -79,14 +89,34 @@ func (u *URL) Resolve(url string) *URL {
 	}
 }
 
-func (u *URL) Request() *Response {
+func (u *URL) Request() (*Response, error) {
+	body := &strings.Builder{}
+	response, err := u.RequestTo(body)
+	if err != nil {
+		return nil, err
+	}
+	response.Body = body.String()
+	return response, nil
+}
+
+// RequestTo sends the request and writes the body to w as it arrives.
+// Body of the returned response is left empty.
+func (u *URL) RequestTo(w io.Writer) (*Response, error) {
+	return u.RequestFunc(func(headers map[string]string) io.Writer {
+		return w
+	})
+}
+
+// RequestFunc is like RequestTo, but the writer of the body is chosen
+// by body once the response headers have been received.
+func (u *URL) RequestFunc(body func(headers map[string]string) io.Writer) (*Response, error) {
 	if u.Scheme == "file" {
-		return u.openFile()
+		return u.openFile(body)
 	}
 
 	conn, err := net.Dial("tcp", u.Host+":"+strconv.Itoa(u.Port))
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	defer conn.Close()
 
@@ -95,7 +125,7 @@ func (u *URL) Request() *Response {
 			ServerName: u.Host,
 		})
 		if err := tlsConn.Handshake(); err != nil {
-			panic(err)
+			return nil, err
 		}
 		defer tlsConn.Close()
 		conn = tlsConn
@@ -104,30 +134,43 @@ func (u *URL) Request() *Response {
 	request := "GET " + u.Path + " HTTP/1.1\r\n"
 	request += "Host: " + u.Host + "\r\n"
 	request += "\r\n"
-	conn.Write([]byte(request))
+	if _, err := conn.Write([]byte(request)); err != nil {
+		return nil, err
+	}
 
 	reader := bufio.NewReader(conn)
 
 	// status line
-	statusLine, _ := readLine(reader)
+	statusLine, err := readLine(reader)
+	if err != nil {
+		return nil, err
+	}
 	parts := strings.SplitN(statusLine, " ", 3)
 	if len(parts) < 2 {
-		println("Invalid response from server")
-		return nil
+		return nil, errors.New("invalid status line: " + statusLine)
 	}
 	version := parts[0]
 	status := parts[1]
-	explanation := parts[2]
+	explanation := ""
+	if len(parts) == 3 {
+		explanation = parts[2]
+	}
 
 	// headers
 	responseHeaders := make(map[string]string)
 	for {
-		line, _ := readLine(reader)
+		line, err := readLine(reader)
+		if err != nil {
+			return nil, err
+		}
 		if line == "" {
 			break // End of headers
 		}
-		parts := strings.SplitN(line, ":", 2)
-		responseHeaders[strings.ToLower(strings.TrimSpace(parts[0]))] = strings.TrimSpace(parts[1])
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		responseHeaders[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
 	}
 
 	// body
@@ -136,26 +179,24 @@ func (u *URL) Request() *Response {
 		println("Content-Length header not found or invalid")
 		size = 0
 	}
-	buf := make([]byte, size)
+	w := body(responseHeaders)
+	buf := make([]byte, 4096)
 
 	for offset := 0; size > offset; {
-		n, err := reader.Read(buf[offset:])
+		n, err := reader.Read(buf[:min(len(buf), size-offset)])
 		if err != nil {
-			println("Error reading response body:", err.Error())
-			return nil
+			return nil, err
 		}
+		w.Write(buf[:n])
 		offset += n
 	}
 
-	content := string(buf)
-
 	return &Response{
 		Status:      status,
 		Version:     version,
 		Explanation: explanation,
 		Headers:     responseHeaders,
-		Body:        content,
-	}
+	}, nil
 }
 
 func readLine(reader *bufio.Reader) (string, error) {
@@ -1,6 +1,8 @@
 package layout
 
 import (
+	"strings"
+
 	"github.com/pishiko/tenmusu/internal/parser/css"
 	"github.com/pishiko/tenmusu/internal/parser/model"
 )
@@ -11,7 +13,10 @@ type BlockLayout struct {
 	previous Layout
 	children []Layout
 
-	prop LayoutProperty
+	prop           LayoutProperty
+	padding        [4]float64 // top, right, bottom and left, inside prop
+	definiteHeight bool       // height does not depend on the contents
+	marker         []*TextLayout
 
 	cursorX   float64
 	weight    string
@@ -26,19 +31,17 @@ func (l BlockLayout) Prop() LayoutProperty {
 func (l *BlockLayout) Paint() []Drawable {
 	ret := []Drawable{}
 	// bgcolor
-	bgcolor, ok := l.node.Style["background-color"]
-	if !ok {
-		bgcolor = "transparent"
-	}
-	if bgcolor != "transparent" {
-		x2, y2 := l.prop.x+l.prop.width, l.prop.y+l.prop.height
-		ret = append(ret, &RectDrawable{
-			top:    l.prop.y,
-			left:   l.prop.x,
-			bottom: y2,
-			right:  x2,
-			color:  css.RGBA(bgcolor),
-		})
+	if bgcolor, ok := l.node.Style["background-color"]; ok {
+		if c := css.RGBA(bgcolor); c.A != 0 {
+			x2, y2 := l.prop.x+l.prop.width, l.prop.y+l.prop.height
+			ret = append(ret, &RectDrawable{
+				top:    l.prop.y,
+				left:   l.prop.x,
+				bottom: y2,
+				right:  x2,
+				color:  c,
+			})
+		}
 	}
 
 	if l.layoutMode() == Inline {
@@ -49,21 +52,67 @@ func (l *BlockLayout) Paint() []Drawable {
 	return ret
 }
 
+// contentBox returns the box the children of l are placed in, inside the padding.
+func (l *BlockLayout) contentBox() LayoutProperty {
+	return LayoutProperty{
+		x:      l.prop.x + l.padding[3],
+		y:      l.prop.y + l.padding[0],
+		width:  max(l.prop.width-l.padding[1]-l.padding[3], 0),
+		height: max(l.prop.height-l.padding[0]-l.padding[2], 0),
+	}
+}
+
+// contentBox returns the box the children of l are placed in.
+func contentBox(l Layout) LayoutProperty {
+	if block, ok := l.(*BlockLayout); ok {
+		return block.contentBox()
+	}
+	return l.Prop()
+}
+
 func (l *BlockLayout) Layout() {
-	l.prop.x = l.parent.Prop().x
-	l.prop.width = l.parent.Prop().width
+	container := contentBox(l.parent)
+	// percentages of padding refer to the width of the containing block
+	for i, side := range []string{"top", "right", "bottom", "left"} {
+		if padding, ok := resolveLength(l.node, "padding-"+side, container.width, true); ok {
+			l.padding[i] = max(padding, 0)
+		}
+	}
+	l.prop.x = container.x
+	l.prop.width = container.width
+	if width, ok := resolveLength(l.node, "width", container.width, true); ok {
+		l.prop.width = max(width, 0) + l.padding[1] + l.padding[3]
+	}
+	// percentages of height only apply when the containing block has a definite height
+	parentDefinite := false
+	if parent, ok := l.parent.(*BlockLayout); ok {
+		parentDefinite = parent.definiteHeight
+	}
+	height, hasHeight := resolveLength(l.node, "height", container.height, parentDefinite)
+	if hasHeight {
+		l.prop.height = max(height, 0) + l.padding[0] + l.padding[2]
+		l.definiteHeight = true
+	}
 	if l.previous != nil {
 		l.prop.y = l.previous.Prop().y + l.previous.Prop().height
 	} else {
-		l.prop.y = l.parent.Prop().y
+		l.prop.y = container.y
 	}
 
 	inlineContext := (*InlineContext)(nil)
 	previous := (Layout)(nil)
-	for _, child := range l.node.Children {
+	for _, child := range boxChildren(l.node) {
+		if child.Type == model.Comment || child.Type == model.Doctype || child.Type == model.ProcessingInstruction {
+			continue
+		}
+		// whitespace at the start of a block or after a block box collapses away
+		if isCollapsibleWhiteSpace(child) && inlineContext == nil {
+			continue
+		}
 		switch getLayoutMode(child) {
 		case Block:
 			if inlineContext != nil {
+				inlineContext.trimWhiteSpace()
 				inlineContext = nil
 			}
 			var next *BlockLayout
@@ -103,12 +152,22 @@ func (l *BlockLayout) Layout() {
 		}
 	}
 
+	if inlineContext != nil {
+		inlineContext.trimWhiteSpace()
+	}
+
 	for _, child := range l.children {
 		child.Layout()
 	}
+	if l.node.Marker != nil && !insideMarker(l.node) {
+		l.layoutMarker()
+	}
 
 	// Height
-	height := 0.0
+	if hasHeight {
+		return
+	}
+	height = l.padding[0] + l.padding[2]
 	for _, child := range l.children {
 		height += child.Prop().height
 	}
@@ -117,12 +176,36 @@ func (l *BlockLayout) Layout() {
 
 func (l *BlockLayout) PaintTree(drawables []Drawable) []Drawable {
 	drawables = append(drawables, l.Paint()...)
+	for _, word := range l.marker {
+		drawables = word.PaintTree(drawables)
+	}
 	for _, child := range l.children {
 		drawables = child.PaintTree(drawables)
 	}
 	return drawables
 }
 
+func (l *BlockLayout) HitTest(x, y float64) *model.Node {
+	if !l.prop.contains(x, y) {
+		return nil
+	}
+	for _, child := range l.children {
+		if node := child.HitTest(x, y); node != nil {
+			return node
+		}
+	}
+	return l.node
+}
+
 func (l *BlockLayout) layoutMode() LayoutMode {
 	return getLayoutMode(l.node)
 }
+
+// isCollapsibleWhiteSpace reports whether node is a text node that only
+// has whitespace which collapses, like indentation between blocks.
+func isCollapsibleWhiteSpace(node *model.Node) bool {
+	if node.Type != model.Text || strings.TrimFunc(node.Value, isCollapsibleSpace) != "" {
+		return false
+	}
+	return !parseWhiteSpace(node.Style["white-space"]).preservesNewlines()
+}
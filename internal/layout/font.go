@@ -1,10 +1,15 @@
 package layout
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/pishiko/tenmusu/internal/font"
+	"github.com/pishiko/tenmusu/internal/parser/css"
+	"github.com/pishiko/tenmusu/internal/parser/model"
 )
 
 var fontSource FontSource
@@ -45,3 +50,104 @@ func init() {
 		bold:   bold,
 	}
 }
+
+// FontFace is a web font registered from @font-face.
+type FontFace struct {
+	css.FontFace
+	Source *text.GoTextFaceSource
+}
+
+var fontFaces []FontFace
+
+// RegisterFontFace makes face available to font-family.
+func RegisterFontFace(face FontFace) {
+	fontFaces = append(fontFaces, face)
+}
+
+// ClearFontFaces forgets the faces registered for the previous document.
+func ClearFontFaces() {
+	fontFaces = nil
+}
+
+// NewFontFaceSource decodes TTF, OTF, WOFF or WOFF2 data.
+func NewFontFaceSource(data []byte) (*text.GoTextFaceSource, error) {
+	sfnt, err := font.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return text.NewGoTextFaceSource(bytes.NewReader(sfnt))
+}
+
+// findFontSource returns the face to draw word with, following font-family,
+// font-weight and font-style of node. Generic and unknown families fall
+// back to the system fonts.
+func findFontSource(node *model.Node, word string) *text.GoTextFaceSource {
+	weight := node.Computed.FontWeight
+	if weight == 0 {
+		weight = 400
+	}
+	for _, family := range strings.Split(node.Style["font-family"], ",") {
+		family = strings.Trim(strings.TrimSpace(family), "\"'")
+		if face := matchFontFace(family, weight, node.Style["font-style"], word); face != nil {
+			return face.Source
+		}
+	}
+	if weight >= 600 {
+		return fontSource.bold
+	}
+	return fontSource.normal
+}
+
+// matchFontFace picks the registered face of family closest to weight and style.
+// https://www.w3.org/TR/css-fonts-4/#font-style-matching
+func matchFontFace(family string, weight int, style string, word string) *FontFace {
+	var best *FontFace
+	bestStyle, bestWeight := 0, 0
+	for i := range fontFaces {
+		face := &fontFaces[i]
+		if !strings.EqualFold(face.Family, family) || !face.Covers(word) {
+			continue
+		}
+		s, w := styleDistance(style, face), weightDistance(weight, face.Weight)
+		if best == nil || s < bestStyle || s == bestStyle && w < bestWeight {
+			best, bestStyle, bestWeight = face, s, w
+		}
+	}
+	return best
+}
+
+func styleDistance(want string, face *FontFace) int {
+	if want == "" {
+		want = "normal"
+	}
+	have := face.Style
+	switch {
+	case want == "oblique" && have == "oblique":
+		// the oblique of the property has the default angle
+		if face.Oblique[0] <= css.DefaultObliqueAngle && css.DefaultObliqueAngle <= face.Oblique[1] {
+			return 0
+		}
+		return 1
+	case want == have:
+		return 0
+	case want != "normal" && have != "normal":
+		// italic and oblique stand in for each other
+		return 1
+	}
+	return 2
+}
+
+// weightDistance prefers lighter faces for light text and heavier faces for bold text.
+func weightDistance(want int, have [2]int) int {
+	switch {
+	case want >= have[0] && want <= have[1]:
+		return 0
+	case want <= 500 && have[1] < want:
+		return want - have[1]
+	case want <= 500:
+		return have[0] - want + 1000
+	case have[0] > want:
+		return have[0] - want
+	}
+	return want - have[1] + 1000
+}
@@ -1,9 +1,7 @@
 package layout
 
 import (
-	"strconv"
-	"strings"
-	"unicode"
+	"image/color"
 
 	"github.com/hajimehoshi/ebiten/v2/text/v2"
 	"github.com/pishiko/tenmusu/internal/parser/css"
@@ -45,18 +43,28 @@ func (l *InlineContext) Paint() []Drawable {
 }
 
 func (l *InlineContext) Layout() {
-	l.prop.x = l.parent.Prop().x
-	l.prop.width = l.parent.Prop().width
+	container := contentBox(l.parent)
+	l.prop.x = container.x
+	l.prop.width = container.width
 	if l.previous != nil {
 		l.prop.y = l.previous.Prop().y + l.previous.Prop().height
 	} else {
-		l.prop.y = l.parent.Prop().y
+		l.prop.y = container.y
 	}
 
 	l.newLine()
 
 	for _, item := range l.inlineItems {
-		l.textItems = append(l.textItems, item.Items()...)
+		for _, txt := range item.Items() {
+			if txt.word == "" && !txt.lineBreak {
+				// collapsible space between words
+				if n := len(l.textItems); n > 0 && !l.textItems[n-1].lineBreak {
+					l.textItems[n-1].spaceAfter = true
+				}
+				continue
+			}
+			l.textItems = append(l.textItems, txt)
+		}
 	}
 	l.word()
 
@@ -72,6 +80,15 @@ func (l *InlineContext) Layout() {
 	l.prop.height = height
 }
 
+// trimWhiteSpace removes the collapsible whitespace at the end of the
+// context, before a block box or the end of the block. Whitespace between
+// inline boxes is kept, to become the space after the previous word.
+func (l *InlineContext) trimWhiteSpace() {
+	for n := len(l.inlineItems); n > 0 && isCollapsibleWhiteSpace(l.inlineItems[n-1].node); n-- {
+		l.inlineItems = l.inlineItems[:n-1]
+	}
+}
+
 func (l *InlineContext) PaintTree(drawables []Drawable) []Drawable {
 	drawables = append(drawables, l.Paint()...)
 	for _, child := range l.children {
@@ -80,10 +97,19 @@ func (l *InlineContext) PaintTree(drawables []Drawable) []Drawable {
 	return drawables
 }
 
+func (l *InlineContext) HitTest(x, y float64) *model.Node {
+	for _, child := range l.children {
+		if node := child.HitTest(x, y); node != nil {
+			return node
+		}
+	}
+	return nil
+}
+
 func (l *InlineContext) word() {
 	for _, txt := range l.textItems {
 		// 右端まで言ったら改行
-		if l.cursorX+txt.prop.width > l.prop.width {
+		if txt.wrap && l.cursorX > 0 && l.cursorX+txt.prop.width > l.prop.width {
 			l.newLine()
 		}
 
@@ -98,8 +124,13 @@ func (l *InlineContext) word() {
 
 		// Update x position for the next character
 		l.cursorX += txt.prop.width
-		spaceWidth, _ := text.Measure(" ", txt.font, txt.font.Metrics().HLineGap)
-		l.cursorX += spaceWidth
+		if txt.spaceAfter {
+			spaceWidth, _ := text.Measure(" ", txt.font, txt.font.Metrics().HLineGap)
+			l.cursorX += spaceWidth
+		}
+		if txt.lineBreak {
+			l.newLine()
+		}
 	}
 }
 
@@ -136,14 +167,14 @@ func (l *InlineLayout) Paint() []Drawable {
 	if len(l.children) == 0 {
 		return ret
 	}
-	// bgcolor
-	bgcolor, ok := l.node.Style["background-color"]
-	if !ok {
-		bgcolor = "transparent"
+	// bgcolor, which text shares with its parent without a box of its own
+	bgcolor := color.RGBA{}
+	if c, ok := l.node.Style["background-color"]; ok && l.node.Type == model.Element {
+		bgcolor = css.RGBA(c)
 	}
 	prevRight := l.children[0].prop.x
 	prevTop := l.children[0].prop.y
-	if bgcolor != "transparent" {
+	if bgcolor.A != 0 {
 		for _, child := range l.children {
 			if child.prop.y > prevTop {
 				prevRight = child.prop.x
@@ -154,7 +185,7 @@ func (l *InlineLayout) Paint() []Drawable {
 				left:   prevRight,
 				bottom: bottom,
 				right:  right,
-				color:  css.RGBA(bgcolor),
+				color:  bgcolor,
 			})
 			prevRight = right
 			prevTop = child.prop.y
@@ -176,7 +207,7 @@ func (l *InlineLayout) recurse(node *model.Node) {
 	switch node.Type {
 	case model.Element:
 		// l.openTag(node.Value)
-		for _, child := range node.Children {
+		for _, child := range boxChildren(node) {
 			l.recurse(child)
 		}
 		// l.closeTag(node.Value)
@@ -187,32 +218,27 @@ func (l *InlineLayout) recurse(node *model.Node) {
 
 func (l *InlineLayout) word(node *model.Node) {
 	l.size = l.parent.size
-	if fs, ok := node.Style["font-size"]; ok {
-		fspx, _ := strings.CutSuffix(fs, "px")
-		fspxInt, _ := strconv.Atoi(fspx)
-		l.size = float64(fspxInt)
+	if _, ok := node.Style["font-size"]; ok {
+		l.size = fontSize(node)
 	}
 
-	for _, word := range strings.FieldsFunc(node.Value, unicode.IsSpace) {
-		if word == "" {
-			continue // Skip empty words
-		}
-		source := fontSource.normal
-		if l.weight == "bold" {
-			source = fontSource.bold
-		}
+	ws := parseWhiteSpace(node.Style["white-space"])
+	for _, seg := range segments(node.Value, ws) {
 		f := &text.GoTextFace{
-			Source:    source,
+			Source:    findFontSource(node, seg.text),
 			Direction: text.DirectionLeftToRight,
 			Size:      l.size,
 			Language:  language.Japanese,
 		}
-		w, _ := text.Measure(word, f, f.Metrics().HLineGap)
+		w, _ := text.Measure(seg.text, f, f.Metrics().HLineGap)
 
 		txt := &TextLayout{
-			node: node,
-			word: word,
-			font: f,
+			node:       node,
+			word:       seg.text,
+			font:       f,
+			spaceAfter: seg.spaceAfter,
+			lineBreak:  seg.lineBreak,
+			wrap:       ws.wraps(),
 		}
 		txt.prop.width = float64(w)
 		l.children = append(l.children, txt)
@@ -32,6 +32,7 @@ func NewDocumentLayout(node *model.Node, screenRect image.Rectangle) *DocumentLa
 
 func (l *DocumentLayout) Layout() []Drawable {
 	parent := &BlockLayout{
+		definiteHeight: true,
 		prop: LayoutProperty{
 			x:      8.0,
 			y:      8.0,
@@ -55,6 +56,20 @@ func (l *DocumentLayout) Layout() []Drawable {
 	return l.drawables
 }
 
+// HitTest returns the element at the point in document coordinates, or nil.
+func (l *DocumentLayout) HitTest(x, y float64) *model.Node {
+	for _, child := range l.children {
+		node := child.HitTest(x, y)
+		for node != nil && node.Type != model.Element {
+			node = node.Parent
+		}
+		if node != nil {
+			return node
+		}
+	}
+	return nil
+}
+
 type LayoutProperty struct {
 	x      float64
 	y      float64
@@ -67,6 +82,52 @@ type Layout interface {
 	Paint() []Drawable
 	Prop() LayoutProperty
 	PaintTree([]Drawable) []Drawable
+	// HitTest returns the deepest node whose box contains the point, or nil.
+	HitTest(x, y float64) *model.Node
+}
+
+func (p LayoutProperty) contains(x, y float64) bool {
+	return x >= p.x && x < p.x+p.width && y >= p.y && y < p.y+p.height
+}
+
+// resolveLength resolves a length property of node to pixels, with
+// percentages relative to base. Percentages of an indefinite base, and
+// values like auto, report false.
+func resolveLength(node *model.Node, property string, base float64, definite bool) (float64, bool) {
+	length, ok := node.Computed.Lengths[property]
+	if !ok || length.Auto || length.UsesPercentage() && !definite {
+		return 0, false
+	}
+	return length.Resolve(base), true
+}
+
+// fontSize returns the computed font size of node in pixels.
+func fontSize(node *model.Node) float64 {
+	if node.Computed.FontSize == 0 {
+		return 16
+	}
+	return node.Computed.FontSize
+}
+
+// boxChildren returns the children of node, with the boxes generated for
+// its pseudo-elements around them. Markers outside the list item are
+// placed by the list item itself.
+func boxChildren(node *model.Node) []*model.Node {
+	if node.Marker == nil && node.Before == nil && node.After == nil {
+		return node.Children
+	}
+	ret := []*model.Node{}
+	if node.Marker != nil && insideMarker(node) {
+		ret = append(ret, node.Marker)
+	}
+	if node.Before != nil {
+		ret = append(ret, node.Before)
+	}
+	ret = append(ret, node.Children...)
+	if node.After != nil {
+		ret = append(ret, node.After)
+	}
+	return ret
 }
 
 func getLayoutMode(node *model.Node) LayoutMode {
@@ -74,6 +135,14 @@ func getLayoutMode(node *model.Node) LayoutMode {
 	case model.Text:
 		return Inline
 	case model.Element:
+		// block-level display values win over the defaults of the element
+		switch strings.ToLower(node.Style["display"]) {
+		case "block", "flow-root", "list-item", "table", "flex", "grid":
+			return Block
+		}
+		if node.Pseudo != "" {
+			return Inline
+		}
 		switch node.Value {
 		case "html", "body", "article", "section", "nav", "aside",
 			"h1", "h2", "h3", "h4", "h5", "h6", "hgroup", "header",
@@ -83,7 +152,7 @@ func getLayoutMode(node *model.Node) LayoutMode {
 			"legend", "details", "summary":
 			return Block
 		default:
-			if len(node.Children) > 0 {
+			if len(boxChildren(node)) > 0 {
 				return Inline
 			}
 		}
@@ -2,8 +2,6 @@ package layout
 
 import (
 	"image/color"
-	"strconv"
-	"strings"
 
 	"github.com/hajimehoshi/ebiten/v2/text/v2"
 	"github.com/pishiko/tenmusu/internal/parser/css"
@@ -22,6 +20,10 @@ type TextLayout struct {
 	font   *text.GoTextFace
 	weight string
 	style  string
+
+	spaceAfter bool // a collapsed space follows this word
+	lineBreak  bool // a preserved newline follows this word
+	wrap       bool // the line may break before this word
 }
 
 func (l *TextLayout) Layout() {
@@ -30,17 +32,10 @@ func (l *TextLayout) Layout() {
 	l.weight, _ = l.node.Style["font-weight"]
 	l.style, _ = l.node.Style["font-style"]
 
-	fs, _ := l.node.Style["font-size"]
-	fspx, _ := strings.CutSuffix(fs, "px")
-	fspxInt, _ := strconv.Atoi(fspx)
-	size := float64(fspxInt)
+	size := fontSize(l.node)
 
-	source := fontSource.normal
-	if l.weight == "bold" {
-		source = fontSource.bold
-	}
 	l.font = &text.GoTextFace{
-		Source:    source,
+		Source:    findFontSource(l.node, l.word),
 		Direction: text.DirectionLeftToRight,
 		Size:      size,
 		Language:  language.Japanese,
@@ -50,9 +45,12 @@ func (l *TextLayout) Layout() {
 	l.prop.height = float64(h)
 
 	if l.previous != nil {
-		preFont := l.previous.font
-		space, _ := text.Measure(" ", preFont, preFont.Metrics().HLineGap)
-		l.prop.x = l.previous.Prop().x + l.previous.Prop().width + float64(space)
+		l.prop.x = l.previous.Prop().x + l.previous.Prop().width
+		if l.previous.spaceAfter {
+			preFont := l.previous.font
+			space, _ := text.Measure(" ", preFont, preFont.Metrics().HLineGap)
+			l.prop.x += float64(space)
+		}
 	}
 
 }
@@ -85,6 +83,13 @@ func (l *TextLayout) PaintTree(drawables []Drawable) []Drawable {
 	return drawables
 }
 
+func (l *TextLayout) HitTest(x, y float64) *model.Node {
+	if l.prop.contains(x, y) {
+		return l.node
+	}
+	return nil
+}
+
 type LineLayout struct {
 	parent   Layout
 	previous Layout
@@ -146,3 +151,12 @@ func (l *LineLayout) PaintTree(drawables []Drawable) []Drawable {
 	}
 	return drawables
 }
+
+func (l *LineLayout) HitTest(x, y float64) *model.Node {
+	for _, child := range l.children {
+		if node := child.HitTest(x, y); node != nil {
+			return node
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package layout
+
+import (
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/pishiko/tenmusu/internal/parser/model"
+)
+
+// insideMarker reports whether the marker of the list item node is the
+// first inline box of its contents, rather than outside of it.
+// https://www.w3.org/TR/css-lists-3/#list-style-position-property
+func insideMarker(node *model.Node) bool {
+	return strings.EqualFold(node.Style["list-style-position"], "inside")
+}
+
+// layoutMarker places the outside marker of the list item at the left of
+// its content box, on the baseline of its first line.
+func (l *BlockLayout) layoutMarker() {
+	inline := &InlineLayout{parent: l, node: l.node.Marker}
+	words := []*TextLayout{}
+	width := 0.0
+	for _, word := range inline.Items() {
+		if word.word == "" {
+			continue
+		}
+		width += word.prop.width
+		if word.spaceAfter {
+			// the space after the marker separates it from the contents
+			space, _ := text.Measure(" ", word.font, word.font.Metrics().HLineGap)
+			width += space
+		}
+		words = append(words, word)
+	}
+	if len(words) == 0 {
+		return
+	}
+
+	box := l.contentBox()
+	baseline := box.y + words[0].font.Metrics().HAscent
+	if line := firstLine(l); line != nil {
+		first := line.children[0]
+		baseline = first.prop.y + first.font.Metrics().HAscent
+	}
+	x := box.x - width
+	for _, word := range words {
+		metrics := word.font.Metrics()
+		word.style = word.node.Style["font-style"]
+		word.weight = word.node.Style["font-weight"]
+		word.prop.x = x
+		word.prop.y = baseline - metrics.HAscent
+		word.prop.height = metrics.HAscent + metrics.HDescent
+		x += word.prop.width
+		if word.spaceAfter {
+			space, _ := text.Measure(" ", word.font, metrics.HLineGap)
+			x += space
+		}
+	}
+	l.marker = words
+}
+
+// firstLine returns the first line with text in layout, or nil.
+func firstLine(layout Layout) *LineLayout {
+	switch l := layout.(type) {
+	case *BlockLayout:
+		for _, child := range l.children {
+			if line := firstLine(child); line != nil {
+				return line
+			}
+		}
+	case *InlineContext:
+		for _, line := range l.children {
+			if len(line.children) > 0 {
+				return line
+			}
+		}
+	}
+	return nil
+}
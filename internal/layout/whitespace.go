@@ -0,0 +1,162 @@
+package layout
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// WhiteSpace is the value of the CSS white-space property.
+type WhiteSpace int
+
+const (
+	WhiteSpaceNormal WhiteSpace = iota
+	WhiteSpaceNoWrap
+	WhiteSpacePre
+	WhiteSpacePreWrap
+	WhiteSpacePreLine
+)
+
+const tabSize = 8
+
+func parseWhiteSpace(s string) WhiteSpace {
+	switch s {
+	case "nowrap":
+		return WhiteSpaceNoWrap
+	case "pre":
+		return WhiteSpacePre
+	case "pre-wrap":
+		return WhiteSpacePreWrap
+	case "pre-line":
+		return WhiteSpacePreLine
+	}
+	return WhiteSpaceNormal
+}
+
+func (ws WhiteSpace) collapsesSpaces() bool {
+	return ws == WhiteSpaceNormal || ws == WhiteSpaceNoWrap || ws == WhiteSpacePreLine
+}
+
+func (ws WhiteSpace) preservesNewlines() bool {
+	return ws == WhiteSpacePre || ws == WhiteSpacePreWrap || ws == WhiteSpacePreLine
+}
+
+func (ws WhiteSpace) wraps() bool {
+	return ws != WhiteSpaceNoWrap && ws != WhiteSpacePre
+}
+
+// segment is a run of text that is laid out as one TextLayout.
+// A segment with empty text and no lineBreak is a collapsible space
+// that separates the previous and the next segment.
+type segment struct {
+	text       string
+	spaceAfter bool
+	lineBreak  bool
+}
+
+func segments(s string, ws WhiteSpace) []segment {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	lines := []string{s}
+	if ws.preservesNewlines() {
+		lines = strings.Split(s, "\n")
+	} else {
+		lines[0] = strings.ReplaceAll(s, "\n", " ")
+	}
+
+	ret := []segment{}
+	for i, line := range lines {
+		last := i == len(lines)-1
+		start := len(ret)
+		if ws.collapsesSpaces() {
+			ret = append(ret, collapsedSegments(line, i > 0, !last)...)
+		} else {
+			ret = append(ret, preservedSegments(line, ws.wraps())...)
+		}
+		if last {
+			break
+		}
+		if len(ret) > start {
+			ret[len(ret)-1].spaceAfter = false
+			ret[len(ret)-1].lineBreak = true
+		} else {
+			ret = append(ret, segment{lineBreak: true})
+		}
+	}
+	return ret
+}
+
+// isCollapsibleSpace reports whether r is document white space, which
+// does not include other Unicode spaces like U+00A0 and U+3000.
+// https://www.w3.org/TR/css-text-3/#white-space
+func isCollapsibleSpace(r rune) bool {
+	switch r {
+	case ' ', '\t', '\n', '\r', '\f':
+		return true
+	}
+	return false
+}
+
+// collapsedSegments splits line into words. Spaces around a preserved
+// newline are removed.
+func collapsedSegments(line string, afterNewline, beforeNewline bool) []segment {
+	ret := []segment{}
+	words := strings.FieldsFunc(line, isCollapsibleSpace)
+	if len(words) == 0 {
+		if line != "" && !afterNewline && !beforeNewline {
+			ret = append(ret, segment{spaceAfter: true})
+		}
+		return ret
+	}
+	first, _ := utf8.DecodeRuneInString(line)
+	if isCollapsibleSpace(first) && !afterNewline {
+		ret = append(ret, segment{spaceAfter: true})
+	}
+	last, _ := utf8.DecodeLastRuneInString(line)
+	endsWithSpace := isCollapsibleSpace(last)
+	for i, word := range words {
+		ret = append(ret, segment{
+			text:       word,
+			spaceAfter: i < len(words)-1 || endsWithSpace,
+		})
+	}
+	return ret
+}
+
+// preservedSegments keeps every space of line. When the line may wrap,
+// it is split after each run of spaces.
+func preservedSegments(line string, wrap bool) []segment {
+	line = expandTabs(line)
+	if line == "" {
+		return []segment{}
+	}
+	if !wrap {
+		return []segment{{text: line}}
+	}
+	ret := []segment{}
+	start := 0
+	for i := 1; i < len(line); i++ {
+		if line[i-1] == ' ' && line[i] != ' ' {
+			ret = append(ret, segment{text: line[start:i]})
+			start = i
+		}
+	}
+	return append(ret, segment{text: line[start:]})
+}
+
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	col := 0
+	for _, r := range line {
+		if r == '\t' {
+			n := tabSize - col%tabSize
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+			continue
+		}
+		b.WriteRune(r)
+		col++
+	}
+	return b.String()
+}
@@ -0,0 +1,439 @@
+package css
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"sync"
+)
+
+// LengthContext is what relative lengths and percentages are resolved against.
+type LengthContext struct {
+	FontSize       float64 // font size of the element, or of its parent for font-size itself
+	RootFontSize   float64
+	ViewportWidth  float64
+	ViewportHeight float64
+	PercentBase    float64 // the size 100% refers to
+}
+
+// initialLengthContext resolves lengths where there is no element, like in media queries.
+var initialLengthContext = LengthContext{FontSize: 16, RootFontSize: 16}
+
+// Length converts n in unit to pixels.
+// https://www.w3.org/TR/css-values-4/#lengths
+func (c LengthContext) Length(n float64, unit string) (float64, bool) {
+	switch strings.ToLower(unit) {
+	case "px":
+		return n, true
+	case "em":
+		return n * c.FontSize, true
+	case "rem":
+		return n * c.RootFontSize, true
+	case "ex", "ch":
+		// without font metrics, both are taken as half of the em
+		return n * c.FontSize / 2, true
+	case "in":
+		return n * 96, true
+	case "cm":
+		return n * 96 / 2.54, true
+	case "mm":
+		return n * 96 / 25.4, true
+	case "q":
+		return n * 96 / 101.6, true
+	case "pt":
+		return n * 96 / 72, true
+	case "pc":
+		return n * 16, true
+	case "vw":
+		return n * c.ViewportWidth / 100, true
+	case "vh":
+		return n * c.ViewportHeight / 100, true
+	case "vmin":
+		return n * min(c.ViewportWidth, c.ViewportHeight) / 100, true
+	case "vmax":
+		return n * max(c.ViewportWidth, c.ViewportHeight) / 100, true
+	}
+	return 0, false
+}
+
+// calcType is the type of a math expression.
+// https://www.w3.org/TR/css-values-4/#calc-type-checking
+type calcType int
+
+const (
+	numberType calcType = iota
+	lengthType
+	percentageType
+	lengthPercentageType // a sum of lengths and percentages
+	angleType
+	timeType
+)
+
+func unitType(unit string) (calcType, bool) {
+	switch strings.ToLower(unit) {
+	case "px", "em", "rem", "ex", "ch", "in", "cm", "mm", "q", "pt", "pc", "vw", "vh", "vmin", "vmax":
+		return lengthType, true
+	case "deg", "grad", "rad", "turn":
+		return angleType, true
+	case "s", "ms":
+		return timeType, true
+	}
+	return 0, false
+}
+
+// addTypes returns the type of a sum, or of the arguments of min(), max() and clamp().
+func addTypes(a, b calcType) (calcType, bool) {
+	isLength := func(t calcType) bool {
+		return t == lengthType || t == percentageType || t == lengthPercentageType
+	}
+	switch {
+	case a == b:
+		return a, true
+	case isLength(a) && isLength(b):
+		return lengthPercentageType, true
+	}
+	return 0, false
+}
+
+// Calc is a math function, like calc(100% - 2em), whose value depends on
+// where it is used. It is resolved at layout time with a LengthContext.
+// https://www.w3.org/TR/css-values-4/#math
+type Calc struct {
+	root calcNode
+	typ  calcType
+}
+
+// IsLength reports whether the expression resolves to a length, possibly through percentages.
+func (c *Calc) IsLength() bool {
+	return c.typ == lengthType || c.typ == percentageType || c.typ == lengthPercentageType
+}
+
+// UsesPercentage reports whether the value depends on what percentages refer to.
+func (c *Calc) UsesPercentage() bool {
+	return c.typ == percentageType || c.typ == lengthPercentageType
+}
+
+// IsNumber reports whether the expression is a plain number.
+func (c *Calc) IsNumber() bool {
+	return c.typ == numberType
+}
+
+// Resolve evaluates the expression. Lengths are in pixels, angles in
+// degrees and times in seconds. NaN becomes 0 and infinities the largest
+// finite values.
+// https://www.w3.org/TR/css-values-4/#top-level-calculation
+func (c *Calc) Resolve(ctx LengthContext) float64 {
+	v := c.root.eval(ctx)
+	switch {
+	case math.IsNaN(v):
+		return 0
+	case math.IsInf(v, 1):
+		return math.MaxFloat64
+	case math.IsInf(v, -1):
+		return -math.MaxFloat64
+	}
+	return v
+}
+
+type calcNode interface {
+	eval(ctx LengthContext) float64
+}
+
+// calcValue is a number, a percentage or a dimension.
+type calcValue struct {
+	n    float64
+	unit string // "%" for percentages, empty for numbers
+}
+
+func (v calcValue) eval(ctx LengthContext) float64 {
+	switch strings.ToLower(v.unit) {
+	case "":
+		return v.n
+	case "%":
+		return v.n * ctx.PercentBase / 100
+	case "deg", "s":
+		return v.n
+	case "grad":
+		return v.n * 360 / 400
+	case "rad":
+		return v.n * 180 / math.Pi
+	case "turn":
+		return v.n * 360
+	case "ms":
+		return v.n / 1000
+	}
+	px, _ := ctx.Length(v.n, v.unit)
+	return px
+}
+
+type calcOp struct {
+	op          byte // + - * /
+	left, right calcNode
+}
+
+func (o calcOp) eval(ctx LengthContext) float64 {
+	a, b := o.left.eval(ctx), o.right.eval(ctx)
+	switch o.op {
+	case '+':
+		return a + b
+	case '-':
+		return a - b
+	case '*':
+		return a * b
+	}
+	return a / b
+}
+
+type calcFunc struct {
+	name string // min, max or clamp
+	args []calcNode
+}
+
+func (f calcFunc) eval(ctx LengthContext) float64 {
+	values := make([]float64, len(f.args))
+	for i, arg := range f.args {
+		values[i] = arg.eval(ctx)
+	}
+	switch f.name {
+	case "min":
+		ret := values[0]
+		for _, v := range values[1:] {
+			ret = min(ret, v)
+		}
+		return ret
+	case "max":
+		ret := values[0]
+		for _, v := range values[1:] {
+			ret = max(ret, v)
+		}
+		return ret
+	}
+	// clamp(MIN, VAL, MAX), where MIN wins over MAX
+	return max(values[0], min(values[1], values[2]))
+}
+
+// IsMathFunction reports whether v is calc(), min(), max() or clamp().
+func IsMathFunction(v ComponentValue) bool {
+	if !v.IsFunction() {
+		return false
+	}
+	switch strings.ToLower(v.Token.Value) {
+	case "calc", "min", "max", "clamp":
+		return true
+	}
+	return false
+}
+
+// ParseCalc parses a math function.
+func ParseCalc(v ComponentValue) (*Calc, error) {
+	if !IsMathFunction(v) {
+		return nil, errors.New("expected calc(), min(), max() or clamp()")
+	}
+	root, typ, err := parseMathFunction(v)
+	if err != nil {
+		return nil, err
+	}
+	return &Calc{root: root, typ: typ}, nil
+}
+
+func parseMathFunction(v ComponentValue) (calcNode, calcType, error) {
+	name := strings.ToLower(v.Token.Value)
+	if name == "calc" {
+		return parseCalcSum(v.Children)
+	}
+	args := splitByComma(v.Children)
+	if name == "clamp" && len(args) != 3 {
+		return nil, 0, errors.New("clamp() takes three arguments")
+	}
+	f := calcFunc{name: name}
+	var typ calcType
+	for i, arg := range args {
+		node, t, err := parseCalcSum(arg)
+		if err != nil {
+			return nil, 0, err
+		}
+		if i > 0 {
+			if t, err = checkedAdd(typ, t); err != nil {
+				return nil, 0, err
+			}
+		}
+		f.args = append(f.args, node)
+		typ = t
+	}
+	return f, typ, nil
+}
+
+func checkedAdd(a, b calcType) (calcType, error) {
+	t, ok := addTypes(a, b)
+	if !ok {
+		return 0, errors.New("incompatible types in math expression")
+	}
+	return t, nil
+}
+
+// parseCalcSum parses <calc-sum>, whose + and - must be surrounded by whitespace.
+func parseCalcSum(values []ComponentValue) (calcNode, calcType, error) {
+	values = trimWhitespace(values)
+	// split into products at + and - delims between whitespace
+	start := 0
+	var node calcNode
+	var typ calcType
+	op := byte('+')
+	for i := 0; i <= len(values); i++ {
+		if i < len(values) {
+			if !(values[i].IsDelim("+") || values[i].IsDelim("-")) {
+				continue
+			}
+			if i == 0 || i == len(values)-1 || !values[i-1].Is(WhitespaceToken) || !values[i+1].Is(WhitespaceToken) {
+				return nil, 0, errors.New("+ and - must be surrounded by whitespace")
+			}
+		}
+		term, t, err := parseCalcProduct(values[start:i])
+		if err != nil {
+			return nil, 0, err
+		}
+		if node == nil {
+			node, typ = term, t
+		} else {
+			if typ, err = checkedAdd(typ, t); err != nil {
+				return nil, 0, err
+			}
+			node = calcOp{op: op, left: node, right: term}
+		}
+		if i < len(values) {
+			op = values[i].Token.Value[0]
+			start = i + 1
+		}
+	}
+	return node, typ, nil
+}
+
+// parseCalcProduct parses <calc-product>, values joined by * and /.
+func parseCalcProduct(values []ComponentValue) (calcNode, calcType, error) {
+	values = nonWhitespace(values)
+	if len(values) == 0 || len(values)%2 == 0 {
+		return nil, 0, errors.New("invalid math expression")
+	}
+	node, typ, err := parseCalcValue(values[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := 1; i < len(values); i += 2 {
+		right, t, err := parseCalcValue(values[i+1])
+		if err != nil {
+			return nil, 0, err
+		}
+		switch {
+		case values[i].IsDelim("*"):
+			if typ != numberType && t != numberType {
+				return nil, 0, errors.New("cannot multiply two dimensions")
+			}
+			if typ == numberType {
+				typ = t
+			}
+			node = calcOp{op: '*', left: node, right: right}
+		case values[i].IsDelim("/"):
+			if t != numberType {
+				return nil, 0, errors.New("cannot divide by a dimension")
+			}
+			node = calcOp{op: '/', left: node, right: right}
+		default:
+			return nil, 0, errors.New("expected * or / in math expression")
+		}
+	}
+	return node, typ, nil
+}
+
+func parseCalcValue(v ComponentValue) (calcNode, calcType, error) {
+	switch {
+	case v.Is(NumberToken):
+		return calcValue{n: v.Token.Number}, numberType, nil
+	case v.Is(PercentageToken):
+		return calcValue{n: v.Token.Number, unit: "%"}, percentageType, nil
+	case v.Is(DimensionToken):
+		t, ok := unitType(v.Token.Unit)
+		if !ok {
+			return nil, 0, errors.New("unknown unit " + v.Token.Unit)
+		}
+		return calcValue{n: v.Token.Number, unit: v.Token.Unit}, t, nil
+	case v.Is(LeftParenToken):
+		return parseCalcSum(v.Children)
+	case IsMathFunction(v):
+		return parseMathFunction(v)
+	case v.IsIdent("pi"):
+		return calcValue{n: math.Pi}, numberType, nil
+	case v.IsIdent("e"):
+		return calcValue{n: math.E}, numberType, nil
+	case v.IsIdent("infinity"):
+		return calcValue{n: math.Inf(1)}, numberType, nil
+	case v.IsIdent("-infinity"):
+		return calcValue{n: math.Inf(-1)}, numberType, nil
+	}
+	return nil, 0, errors.New("unexpected " + v.String() + " in math expression")
+}
+
+// parsedLengths caches ParseLength, which every element calls for each of
+// its lengths, though few distinct values appear in a document. It is
+// emptied once it holds maxParsedLengths values, so that the values of
+// documents loaded one after another do not pile up.
+var parsedLengths = struct {
+	sync.Mutex
+	values map[string]*Calc // nil when the value is not a length
+}{values: map[string]*Calc{}}
+
+const maxParsedLengths = 4096
+
+// ParseLength parses a length, a percentage, or a math function resolving to a length.
+func ParseLength(s string) (*Calc, bool) {
+	parsedLengths.Lock()
+	defer parsedLengths.Unlock()
+	if c, ok := parsedLengths.values[s]; ok {
+		return c, c != nil
+	}
+	c, ok := parseLength(s)
+	if !ok {
+		c = nil
+	}
+	if len(parsedLengths.values) >= maxParsedLengths {
+		clear(parsedLengths.values)
+	}
+	parsedLengths.values[s] = c
+	return c, ok
+}
+
+func parseLength(s string) (*Calc, bool) {
+	parser := newCSSParser("", s)
+	values := trimWhitespace(parser.componentValues())
+	if len(values) != 1 {
+		return nil, false
+	}
+	v := values[0]
+	var c *Calc
+	switch {
+	case v.Is(NumberToken) && v.Token.Number == 0:
+		c = &Calc{root: calcValue{}, typ: lengthType}
+	case v.Is(PercentageToken), v.Is(DimensionToken):
+		root, typ, err := parseCalcValue(v)
+		if err != nil {
+			return nil, false
+		}
+		c = &Calc{root: root, typ: typ}
+	case IsMathFunction(v):
+		var err error
+		if c, err = ParseCalc(v); err != nil {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+	return c, c.IsLength()
+}
+
+// ResolveLength parses s with ParseLength and resolves it to pixels.
+func ResolveLength(s string, ctx LengthContext) (float64, bool) {
+	c, ok := ParseLength(s)
+	if !ok {
+		return 0, false
+	}
+	return c.Resolve(ctx), true
+}
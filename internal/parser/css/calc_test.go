@@ -0,0 +1,92 @@
+package css
+
+import (
+	"math"
+	"testing"
+)
+
+func TestResolveLength(t *testing.T) {
+	ctx := LengthContext{FontSize: 20, RootFontSize: 16, ViewportWidth: 800, ViewportHeight: 600, PercentBase: 400}
+	tests := []struct {
+		value string
+		want  float64
+	}{
+		{"0", 0},
+		{"10px", 10},
+		{"50%", 200},
+		{"calc(100% - 2em)", 360},
+		{"calc(100% - 2em - 1rem)", 344},
+		{"calc(10px + 2 * 3px)", 16},
+		{"calc((10px + 2px) * 3)", 36},
+		{"calc(1in / 2)", 48},
+		{"calc(-1 * (50vw - 10px))", -390},
+		{"min(50%, 300px)", 200},
+		{"max(50%, 300px)", 300},
+		{"min(1em, 1rem, 18px)", 16},
+		{"clamp(100px, 50%, 300px)", 200},
+		{"clamp(100px, 10%, 300px)", 100},
+		{"clamp(100px, 100%, 300px)", 300},
+		// MIN wins over MAX
+		{"clamp(300px, 50%, 100px)", 300},
+		{"calc(clamp(1em, 5vw, 2em) + 1px)", 41},
+		{"CALC(1PX + 1EM)", 21},
+		{"calc(infinity * 1px)", math.MaxFloat64},
+		{"calc(-infinity * 1px)", -math.MaxFloat64},
+		{"calc(0px * (0 / 0))", 0},
+	}
+	for _, test := range tests {
+		got, ok := ResolveLength(test.value, ctx)
+		if !ok || got != test.want {
+			t.Errorf("%s = %v, %v, want %v", test.value, got, ok, test.want)
+		}
+	}
+}
+
+func TestCalcTypeChecking(t *testing.T) {
+	tests := []string{
+		"calc(1px + 1)",
+		"calc(1px+1px)",
+		"calc(1px -1px)",
+		"calc(2px * 3px)",
+		"calc(1px / 1px)",
+		"calc(1px * )",
+		"calc(10deg)",
+		"calc(1px + 10deg)",
+		"calc(2)",
+		"calc(1foo)",
+		"calc(red)",
+		"min(1px, 1)",
+		"clamp(1px, 2px)",
+		"clamp(1px, 2px, 3px, 4px)",
+		"1",
+		"10px 10px",
+	}
+	for _, test := range tests {
+		if c, ok := ParseLength(test); ok {
+			t.Errorf("%s is a length, %v", test, c)
+		}
+	}
+}
+
+func TestCalcTypes(t *testing.T) {
+	tests := []struct {
+		value              string
+		number, percentage bool
+	}{
+		{"calc(1 + 2 * pi)", true, false},
+		{"calc(100% - 2em)", false, true},
+		{"min(10%, 20%)", false, true},
+		{"calc(50% - 50%)", false, true},
+		{"max(1px, 2em)", false, false},
+	}
+	for _, test := range tests {
+		c, err := ParseCalc(valuesOf(test.value)[0])
+		if err != nil {
+			t.Errorf("%s: %v", test.value, err)
+			continue
+		}
+		if c.IsNumber() != test.number || c.UsesPercentage() != test.percentage {
+			t.Errorf("%s: IsNumber %v and UsesPercentage %v, want %v and %v", test.value, c.IsNumber(), c.UsesPercentage(), test.number, test.percentage)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package css
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pishiko/tenmusu/internal/parser/model"
+)
+
+// Origin is where a stylesheet comes from.
+// https://www.w3.org/TR/css-cascade-4/#cascading-origins
+type Origin int
+
+const (
+	UserAgentOrigin Origin = iota
+	UserOrigin
+	AuthorOrigin
+)
+
+// cascadedDeclaration is a declaration that applies to an element, with
+// what decides its precedence.
+type cascadedDeclaration struct {
+	decl        Declaration
+	origin      Origin
+	inline      bool // from the style attribute
+	specificity Specificity
+	order       int // source order across all stylesheets
+}
+
+// rank orders the origins and importance: normal declarations from the
+// user agent, user and author, then important ones in the reverse order.
+func (c cascadedDeclaration) rank() int {
+	if c.decl.Important {
+		return 5 - int(c.origin)
+	}
+	return int(c.origin)
+}
+
+// cascade returns the declarations applying to node, sorted from the
+// lowest to the highest precedence. rules must be in source order.
+func cascade(node *model.Node, rules []CSSRule) []cascadedDeclaration {
+	ret := []cascadedDeclaration{}
+	order := 0
+	for _, decl := range presentationalHints(node) {
+		// before any author rule, with zero specificity
+		order++
+		ret = append(ret, cascadedDeclaration{decl: decl, origin: AuthorOrigin, order: order})
+	}
+	for _, rule := range rules {
+		specificity, matched := rule.match(node)
+		for _, decl := range rule.Body {
+			order++
+			if !matched {
+				continue
+			}
+			ret = append(ret, cascadedDeclaration{
+				decl:        decl,
+				origin:      rule.Origin,
+				specificity: specificity,
+				order:       order,
+			})
+		}
+	}
+	if styleText, ok := node.Attrs["style"]; ok {
+		for _, decl := range InlineCSSParse(styleText) {
+			order++
+			ret = append(ret, cascadedDeclaration{
+				decl:   decl,
+				origin: AuthorOrigin,
+				inline: true,
+				order:  order,
+			})
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		a, b := ret[i], ret[j]
+		if a.rank() != b.rank() {
+			return a.rank() < b.rank()
+		}
+		if a.inline != b.inline {
+			return b.inline
+		}
+		if c := a.specificity.Compare(b.specificity); c != 0 {
+			return c < 0
+		}
+		return a.order < b.order
+	})
+	return ret
+}
+
+// match returns the highest specificity among the selectors of the rule matching node.
+func (rule CSSRule) match(node *model.Node) (Specificity, bool) {
+	ret := Specificity{}
+	matched := false
+	for _, s := range rule.Selectors {
+		// pseudo-elements only match their own boxes, and other selectors only elements
+		pseudo, isPseudo := s.(*PseudoElementSelector)
+		if isPseudo != (node.Pseudo != "") || isPseudo && pseudo.name != node.Pseudo || !s.Matches(node) {
+			continue
+		}
+		if !matched || s.Specificity().Compare(ret) > 0 {
+			ret = s.Specificity()
+		}
+		matched = true
+	}
+	return ret, matched
+}
+
+// presentationalHints returns the declarations HTML attributes map to,
+// which are only the numbering of lists for now.
+// https://html.spec.whatwg.org/multipage/rendering.html#lists
+func presentationalHints(node *model.Node) []Declaration {
+	if node.Type != model.Element || node.Pseudo != "" {
+		return nil
+	}
+	hint := func(name, value string) Declaration {
+		return Declaration{Name: name, Value: valuesOf(value)}
+	}
+	ret := []Declaration{}
+	switch node.Value {
+	case "ol":
+		_, reversed := node.Attrs["reversed"]
+		start, ok := parseHTMLInteger(node.Attrs["start"])
+		switch {
+		case ok && reversed:
+			ret = append(ret, hint("counter-reset", "list-item "+strconv.Itoa(start+1)))
+		case ok:
+			ret = append(ret, hint("counter-reset", "list-item "+strconv.Itoa(start-1)))
+		case reversed:
+			items := 0
+			for _, child := range node.Children {
+				if child.Type == model.Element && child.Value == "li" {
+					items++
+				}
+			}
+			ret = append(ret, hint("counter-reset", "list-item "+strconv.Itoa(items+1)))
+		}
+	case "li":
+		if node.Parent != nil && node.Parent.Value == "ol" {
+			if _, reversed := node.Parent.Attrs["reversed"]; reversed {
+				ret = append(ret, hint("counter-increment", "list-item -1"))
+			}
+		}
+		if value, ok := parseHTMLInteger(node.Attrs["value"]); ok {
+			ret = append(ret, hint("counter-set", "list-item "+strconv.Itoa(value)))
+		}
+	}
+	return ret
+}
+
+// parseHTMLInteger parses an attribute with the rules for parsing
+// integers, which ignore what follows the digits.
+// https://html.spec.whatwg.org/multipage/common-microsyntaxes.html#rules-for-parsing-integers
+func parseHTMLInteger(s string) (int, bool) {
+	s = strings.TrimLeft(s, " \t\n\f\r")
+	end := 0
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		end = 1
+	}
+	for end < len(s) && '0' <= s[end] && s[end] <= '9' {
+		end++
+	}
+	n, err := strconv.Atoi(s[:end])
+	return n, err == nil
+}
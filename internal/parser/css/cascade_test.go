@@ -0,0 +1,105 @@
+package css
+
+import (
+	"testing"
+
+	"github.com/pishiko/tenmusu/internal/parser/html"
+	"github.com/pishiko/tenmusu/internal/parser/model"
+)
+
+var testMedia = Media{Type: "screen", Width: 800, Height: 600}
+
+// sheet parses a stylesheet of origin.
+func sheet(origin Origin, s string) []CSSRule {
+	rules, _ := CSSParseFile("", s, origin)
+	return rules
+}
+
+// styleDocument parses markup and styles it with the sheets in order.
+func styleDocument(markup string, sheets ...[]CSSRule) *model.Node {
+	doc := html.Parse(markup)
+	rules := []CSSRule{}
+	for _, s := range sheets {
+		rules = append(rules, s...)
+	}
+	ApplyStyle(doc, rules, testMedia)
+	return doc
+}
+
+// styleTest is the value of a property of the element with the id.
+type styleTest struct {
+	id, property, want string
+}
+
+func checkStyles(t *testing.T, name string, doc *model.Node, tests []styleTest) {
+	t.Helper()
+	for _, test := range tests {
+		node := doc.GetElementByID(test.id)
+		if node == nil {
+			t.Fatalf("%s: no element #%s", name, test.id)
+		}
+		if got := node.Style[test.property]; got != test.want {
+			t.Errorf("%s: %s of #%s = %q, want %q", name, test.property, test.id, got, test.want)
+		}
+	}
+}
+
+func TestCascadeOrder(t *testing.T) {
+	const markup = `<div id="d" class="c">a</div>`
+	tests := []struct {
+		name   string
+		sheets [][]CSSRule
+		want   string // color of #d
+	}{
+		{"source order", [][]CSSRule{sheet(AuthorOrigin, "div { color: red } div { color: blue }")}, "blue"},
+		{"class over type", [][]CSSRule{sheet(AuthorOrigin, ".c { color: blue } div { color: red }")}, "blue"},
+		{"id over class", [][]CSSRule{sheet(AuthorOrigin, "#d { color: blue } div.c.c { color: red }")}, "blue"},
+		{"highest selector of a list", [][]CSSRule{sheet(AuthorOrigin, "div, #d { color: blue } .c { color: red }")}, "blue"},
+		{"author over user", [][]CSSRule{
+			sheet(AuthorOrigin, "div { color: blue }"),
+			sheet(UserOrigin, "#d { color: red }"),
+		}, "blue"},
+		{"user over user agent", [][]CSSRule{
+			sheet(UserOrigin, "div { color: blue }"),
+			sheet(UserAgentOrigin, "#d { color: red }"),
+		}, "blue"},
+		{"important over specificity", [][]CSSRule{sheet(AuthorOrigin, "div { color: blue !important } #d { color: red }")}, "blue"},
+		{"important user over author", [][]CSSRule{
+			sheet(UserOrigin, "div { color: blue !important }"),
+			sheet(AuthorOrigin, "#d { color: red !important }"),
+		}, "blue"},
+		{"important user agent over user", [][]CSSRule{
+			sheet(UserAgentOrigin, "div { color: blue !important }"),
+			sheet(UserOrigin, "#d { color: red !important }"),
+		}, "blue"},
+	}
+	for _, test := range tests {
+		doc := styleDocument(markup, test.sheets...)
+		checkStyles(t, test.name, doc, []styleTest{{"d", "color", test.want}})
+	}
+}
+
+func TestInlineStyle(t *testing.T) {
+	tests := []struct {
+		name   string
+		markup string
+		sheet  string
+		want   []styleTest
+	}{
+		{"over an id", `<p id="p" style="color: blue">a</p>`, "#p { color: red }", []styleTest{{"p", "color", "blue"}}},
+		{"under important", `<p id="p" style="color: red">a</p>`, "p { color: blue !important }", []styleTest{{"p", "color", "blue"}}},
+		{"important over important", `<p id="p" style="color: blue !important">a</p>`, "#p { color: red !important }", []styleTest{{"p", "color", "blue"}}},
+		{"layered on the sheet", `<p id="p" style="color: blue">a</p>`, "p { font-style: italic }", []styleTest{
+			{"p", "color", "blue"},
+			{"p", "font-style", "italic"},
+		}},
+		{"keeps inherited values", `<div style="color: blue"><p id="p" style="font-style: italic">a</p></div>`, "", []styleTest{
+			{"p", "color", "blue"},
+			{"p", "font-style", "italic"},
+		}},
+	}
+	for _, test := range tests {
+		doc := styleDocument(test.markup, sheet(AuthorOrigin, test.sheet))
+		checkStyles(t, test.name, doc, test.want)
+	}
+}
@@ -1,8 +1,9 @@
 package css
 
 import (
-	"fmt"
 	"image/color"
+	"math"
+	"strconv"
 	"strings"
 )
 
@@ -157,36 +158,264 @@ var NamedColors = map[string]string{
 	"yellowgreen":          "#9acd32",
 }
 
+// RGBA parses a color, or returns transparent black when s is not one.
+// The result is alpha-premultiplied, like all color.RGBA values. It is
+// called when painting, so invalid colors are not reported here: the
+// parser has already reported them as invalid declarations.
 func RGBA(s string) color.RGBA {
-	if hex, ok := NamedColors[s]; ok {
-		return HexToRGBA(hex)
+	c, _ := ParseColor(s)
+	return c
+}
+
+// ParseColor parses a named color, a hex color, or rgb(), rgba(), hsl(),
+// hsla() and hwb(). currentColor is resolved at computed-value time and
+// is not accepted here.
+// https://www.w3.org/TR/css-color-4/
+func ParseColor(s string) (color.RGBA, bool) {
+	values := trimWhitespace(newCSSParser("", s).componentValues())
+	if len(values) != 1 {
+		return color.RGBA{}, false
+	}
+	c, ok := parseColor(values[0])
+	if !ok {
+		return color.RGBA{}, false
+	}
+	return color.RGBAModel.Convert(c).(color.RGBA), true
+}
+
+func parseColor(v ComponentValue) (color.NRGBA, bool) {
+	switch {
+	case v.Is(HashToken):
+		return parseHex(v.Token.Value)
+	case v.Is(IdentToken):
+		name := strings.ToLower(v.Token.Value)
+		if name == "transparent" {
+			return color.NRGBA{}, true
+		}
+		hex, ok := NamedColors[name]
+		if !ok {
+			return color.NRGBA{}, false
+		}
+		return parseHex(hex[1:])
+	case v.IsFunction():
+		switch strings.ToLower(v.Token.Value) {
+		case "rgb", "rgba":
+			return parseRGB(v.Children)
+		case "hsl", "hsla":
+			return parseHSL(v.Children)
+		case "hwb":
+			return parseHWB(v.Children)
+		}
 	}
-	return HexToRGBA(s)
+	return color.NRGBA{}, false
 }
 
-// Params:
-//   - hex: like "#12abff"
-func HexToRGBA(hex string) color.RGBA {
-	var r, g, b uint8
-	if strings.HasPrefix(hex, "#") {
-		if len(hex) == 4 {
-			_, err := fmt.Sscanf(hex, "#%1x%1x%1x", &r, &g, &b)
-			if err != nil {
-				println("[COLOR] error parsing hex color:", err)
-				return color.RGBA{255, 255, 255, 0}
+// parseHex parses the digits of a hex color, each of them doubled in the
+// short forms.
+func parseHex(digits string) (color.NRGBA, bool) {
+	n, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, false
+	}
+	switch len(digits) {
+	case 3:
+		n = n<<4 | 0xf
+		fallthrough
+	case 4:
+		// #rgba is #rrggbbaa
+		c := color.NRGBA{uint8(n >> 12 & 0xf), uint8(n >> 8 & 0xf), uint8(n >> 4 & 0xf), uint8(n & 0xf)}
+		return color.NRGBA{c.R * 0x11, c.G * 0x11, c.B * 0x11, c.A * 0x11}, true
+	case 6:
+		n = n<<8 | 0xff
+		fallthrough
+	case 8:
+		return color.NRGBA{uint8(n >> 24), uint8(n >> 16), uint8(n >> 8), uint8(n)}, true
+	}
+	return color.NRGBA{}, false
+}
+
+// colorArgs splits the arguments of a color function into its three
+// channels and its alpha, in the legacy comma-separated syntax or in the
+// modern space-separated one, like rgb(255 0 0 / 50%).
+func colorArgs(values []ComponentValue) (channels []ComponentValue, alpha *ComponentValue, legacy bool, ok bool) {
+	if parts := splitByComma(values); len(parts) > 1 {
+		if len(parts) != 3 && len(parts) != 4 {
+			return nil, nil, false, false
+		}
+		for _, part := range parts {
+			part = nonWhitespace(part)
+			if len(part) != 1 {
+				return nil, nil, false, false
 			}
-			r = r*17 + r
-			g = g*17 + g
-			b = b*17 + b
-		} else if len(hex) == 7 {
-			_, err := fmt.Sscanf(hex[1:], "%02x%02x%02x", &r, &g, &b)
-			if err != nil {
-				println("[COLOR] error parsing hex color:", err)
-				return color.RGBA{255, 255, 255, 0}
+			channels = append(channels, part[0])
+		}
+		if len(channels) == 4 {
+			alpha = &channels[3]
+		}
+		return channels[:3], alpha, true, true
+	}
+	values = nonWhitespace(values)
+	for i, v := range values {
+		if v.IsDelim("/") {
+			if i != 3 || len(values) != 5 {
+				return nil, nil, false, false
 			}
+			return values[:3], &values[4], false, true
+		}
+	}
+	if len(values) != 3 {
+		return nil, nil, false, false
+	}
+	return values, nil, false, true
+}
+
+// colorAlpha reads an alpha value, a number from 0 to 1 or a percentage.
+func colorAlpha(v *ComponentValue) (float64, bool) {
+	switch {
+	case v == nil:
+		return 1, true
+	case v.Is(NumberToken):
+		return clamp01(v.Token.Number), true
+	case v.Is(PercentageToken):
+		return clamp01(v.Token.Number / 100), true
+	case v.IsIdent("none"):
+		return 0, true
+	}
+	return 0, false
+}
+
+// parseRGB parses the arguments of rgb() and rgba(). The legacy syntax
+// takes either all numbers or all percentages.
+func parseRGB(values []ComponentValue) (color.NRGBA, bool) {
+	channels, alphaValue, legacy, ok := colorArgs(values)
+	if !ok {
+		return color.NRGBA{}, false
+	}
+	rgb := [3]float64{}
+	for i, v := range channels {
+		switch {
+		case v.Is(NumberToken):
+			rgb[i] = v.Token.Number / 255
+		case v.Is(PercentageToken):
+			rgb[i] = v.Token.Number / 100
+		case v.IsIdent("none") && !legacy:
+		default:
+			return color.NRGBA{}, false
+		}
+		if legacy && v.Token.Type != channels[0].Token.Type {
+			return color.NRGBA{}, false
 		}
 	}
+	alpha, ok := colorAlpha(alphaValue)
+	if !ok {
+		return color.NRGBA{}, false
+	}
+	return nrgba(rgb[0], rgb[1], rgb[2], alpha), true
+}
 
-	return color.RGBA{R: r, G: g, B: b, A: 255}
+// parseHSL parses the arguments of hsl() and hsla(). The legacy syntax
+// takes percentages for saturation and lightness.
+func parseHSL(values []ComponentValue) (color.NRGBA, bool) {
+	channels, alphaValue, legacy, ok := colorArgs(values)
+	if !ok {
+		return color.NRGBA{}, false
+	}
+	hue, ok := colorHue(channels[0], legacy)
+	if !ok {
+		return color.NRGBA{}, false
+	}
+	sl := [2]float64{}
+	for i, v := range channels[1:] {
+		switch {
+		case v.Is(PercentageToken):
+			sl[i] = clamp01(v.Token.Number / 100)
+		case v.Is(NumberToken) && !legacy:
+			sl[i] = clamp01(v.Token.Number / 100)
+		case v.IsIdent("none") && !legacy:
+		default:
+			return color.NRGBA{}, false
+		}
+	}
+	alpha, ok := colorAlpha(alphaValue)
+	if !ok {
+		return color.NRGBA{}, false
+	}
+	r, g, b := hslToRGB(hue, sl[0], sl[1])
+	return nrgba(r, g, b, alpha), true
+}
 
+// parseHWB parses the arguments of hwb(), which has no legacy syntax.
+func parseHWB(values []ComponentValue) (color.NRGBA, bool) {
+	channels, alphaValue, legacy, ok := colorArgs(values)
+	if !ok || legacy {
+		return color.NRGBA{}, false
+	}
+	hue, ok := colorHue(channels[0], false)
+	if !ok {
+		return color.NRGBA{}, false
+	}
+	wb := [2]float64{}
+	for i, v := range channels[1:] {
+		switch {
+		case v.Is(PercentageToken), v.Is(NumberToken):
+			wb[i] = clamp01(v.Token.Number / 100)
+		case v.IsIdent("none"):
+		default:
+			return color.NRGBA{}, false
+		}
+	}
+	alpha, ok := colorAlpha(alphaValue)
+	if !ok {
+		return color.NRGBA{}, false
+	}
+	white, black := wb[0], wb[1]
+	if white+black >= 1 {
+		gray := white / (white + black)
+		return nrgba(gray, gray, gray, alpha), true
+	}
+	r, g, b := hslToRGB(hue, 1, 0.5)
+	scale := 1 - white - black
+	return nrgba(r*scale+white, g*scale+white, b*scale+white, alpha), true
+}
+
+// colorHue reads a hue in degrees, a number or an angle.
+func colorHue(v ComponentValue, legacy bool) (float64, bool) {
+	switch {
+	case v.Is(NumberToken):
+		return v.Token.Number, true
+	case v.Is(DimensionToken):
+		if t, ok := unitType(v.Token.Unit); ok && t == angleType {
+			return calcValue{n: v.Token.Number, unit: v.Token.Unit}.eval(initialLengthContext), true
+		}
+	case v.IsIdent("none") && !legacy:
+		return 0, true
+	}
+	return 0, false
+}
+
+// hslToRGB converts a hue in degrees, and saturation and lightness from 0 to 1.
+// https://www.w3.org/TR/css-color-4/#hsl-to-rgb
+func hslToRGB(hue, saturation, lightness float64) (float64, float64, float64) {
+	hue = math.Mod(hue, 360)
+	if hue < 0 {
+		hue += 360
+	}
+	f := func(n float64) float64 {
+		k := math.Mod(n+hue/30, 12)
+		a := saturation * min(lightness, 1-lightness)
+		return lightness - a*max(-1, min(k-3, 9-k, 1))
+	}
+	return f(0), f(8), f(4)
+}
+
+func clamp01(v float64) float64 {
+	return max(0, min(v, 1))
+}
+
+// nrgba converts channels from 0 to 1.
+func nrgba(r, g, b, a float64) color.NRGBA {
+	channel := func(v float64) uint8 {
+		return uint8(math.Round(clamp01(v) * 255))
+	}
+	return color.NRGBA{channel(r), channel(g), channel(b), channel(a)}
 }
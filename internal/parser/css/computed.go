@@ -0,0 +1,251 @@
+package css
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pishiko/tenmusu/internal/parser/model"
+)
+
+// Computed values.
+// https://www.w3.org/TR/css-cascade-4/#computed
+
+// fontSizeKeywords are the absolute font sizes, for a medium of 16px.
+// https://www.w3.org/TR/css-fonts-4/#absolute-size-mapping
+var fontSizeKeywords = map[string]float64{
+	"xx-small":  9,
+	"x-small":   10,
+	"small":     13,
+	"medium":    16,
+	"large":     18,
+	"x-large":   24,
+	"xx-large":  32,
+	"xxx-large": 48,
+}
+
+// lengthProperties are the properties computed to a model.Length.
+var lengthProperties = map[string]bool{
+	"width": true, "height": true,
+	"min-width": true, "min-height": true,
+	"max-width": true, "max-height": true,
+	"margin-top": true, "margin-right": true, "margin-bottom": true, "margin-left": true,
+	"padding-top": true, "padding-right": true, "padding-bottom": true, "padding-left": true,
+	"border-top-width": true, "border-right-width": true, "border-bottom-width": true, "border-left-width": true,
+	"top": true, "right": true, "bottom": true, "left": true,
+	"text-indent": true,
+}
+
+// colorProperties are the properties taking a color, where currentColor
+// refers to the color property.
+var colorProperties = []string{
+	"background-color",
+	"border-top-color", "border-right-color", "border-bottom-color", "border-left-color",
+	"outline-color", "text-decoration-color",
+}
+
+// lineWidths are the keywords of border widths.
+var lineWidths = map[string]float64{
+	"thin":   1,
+	"medium": 3,
+	"thick":  5,
+}
+
+// computeStyle fills node.Computed from node.Style, once the cascade is
+// done and the parent is computed. font-size and font-weight in Style are
+// replaced with their computed values, so that they inherit as such.
+func computeStyle(node *model.Node, media Media) {
+	parent := model.ComputedStyle{FontSize: fontSizeKeywords["medium"], FontWeight: 400}
+	if node.Parent != nil {
+		parent = node.Parent.Computed
+	}
+	ctx := LengthContext{
+		FontSize:       parent.FontSize,
+		RootFontSize:   rootFontSize(node),
+		ViewportWidth:  media.Width,
+		ViewportHeight: media.Height,
+		PercentBase:    parent.FontSize,
+	}
+
+	computed := model.ComputedStyle{
+		FontSize:         computeFontSize(node.Style["font-size"], ctx),
+		FontWeight:       computeFontWeight(node.Style["font-weight"], parent.FontWeight),
+		Lengths:          map[string]model.Length{},
+		ViewportRelative: viewportRelative(node.Style["font-size"]),
+	}
+	node.Style["font-size"] = strconv.FormatFloat(computed.FontSize, 'f', -1, 64) + "px"
+	node.Style["font-weight"] = strconv.Itoa(computed.FontWeight)
+
+	// currentColor in color itself is the inherited color
+	if strings.EqualFold(node.Style["color"], "currentcolor") {
+		node.Style["color"] = properties["color"].initial
+		if node.Parent != nil {
+			node.Style["color"] = node.Parent.Style["color"]
+		}
+	}
+	for _, name := range colorProperties {
+		if strings.EqualFold(node.Style[name], "currentcolor") {
+			node.Style[name] = node.Style["color"]
+		}
+	}
+
+	// other lengths refer to the font size of the element itself
+	ctx.FontSize = computed.FontSize
+	if node.Type == model.Element && (node.Parent == nil || node.Parent.Type != model.Element) {
+		// rem of the root element refers to its own font size, except in font-size
+		ctx.RootFontSize = computed.FontSize
+	}
+	for name := range lengthProperties {
+		if length, ok := computeLength(node.Style[name], ctx); ok {
+			computed.Lengths[name] = length
+			computed.ViewportRelative = computed.ViewportRelative || viewportRelative(node.Style[name])
+		}
+	}
+	// a border without style has no width
+	for _, side := range []string{"top", "right", "bottom", "left"} {
+		switch strings.ToLower(node.Style["border-"+side+"-style"]) {
+		case "none", "hidden":
+			computed.Lengths["border-"+side+"-width"] = model.Length{}
+		}
+	}
+	node.Computed = computed
+}
+
+// computeFontSize resolves a font-size to pixels, or keeps the size of the
+// parent, which ctx refers to, when it is invalid.
+func computeFontSize(value string, ctx LengthContext) float64 {
+	value = strings.ToLower(value)
+	if size, ok := fontSizeKeywords[value]; ok {
+		return size
+	}
+	switch value {
+	case "larger":
+		return ctx.FontSize * 1.2
+	case "smaller":
+		return ctx.FontSize / 1.2
+	}
+	if size, ok := ResolveLength(value, ctx); ok && size >= 0 {
+		return size
+	}
+	return ctx.FontSize
+}
+
+// computeFontWeight resolves a font-weight to a number, with bolder and
+// lighter relative to the weight of the parent.
+// https://www.w3.org/TR/css-fonts-4/#relative-weights
+func computeFontWeight(value string, parent int) int {
+	switch strings.ToLower(value) {
+	case "bolder":
+		switch {
+		case parent < 350:
+			return 400
+		case parent < 550:
+			return 700
+		case parent < 900:
+			return 900
+		}
+		return parent
+	case "lighter":
+		switch {
+		case parent < 100:
+			return parent
+		case parent < 550:
+			return 100
+		case parent < 750:
+			return 400
+		}
+		return 700
+	}
+	if weight, ok := FontWeight(value); ok {
+		return weight
+	}
+	return parent
+}
+
+// computeLength resolves the absolute and relative units of a length,
+// keeping percentages for layout to resolve.
+func computeLength(value string, ctx LengthContext) (model.Length, bool) {
+	value = strings.ToLower(value)
+	switch value {
+	case "auto", "none":
+		return model.Length{Auto: true}, true
+	}
+	if px, ok := lineWidths[value]; ok {
+		return model.Length{Px: px}, true
+	}
+	c, ok := ParseLength(value)
+	if !ok {
+		return model.Length{}, false
+	}
+	if !c.UsesPercentage() {
+		return model.Length{Px: c.Resolve(ctx)}, true
+	}
+	if isLinear(c.root) {
+		// a sum like calc(50% - 1em) is kept as its length and percentage parts
+		ctx.PercentBase = 0
+		px := c.Resolve(ctx)
+		ctx.PercentBase = 100
+		return model.Length{Px: px, Percent: c.Resolve(ctx) - px}, true
+	}
+	return model.Length{Calc: func(base float64) float64 {
+		ctx := ctx
+		ctx.PercentBase = base
+		return c.Resolve(ctx)
+	}}, true
+}
+
+// viewportRelative reports whether the length value has viewport units.
+func viewportRelative(value string) bool {
+	if !strings.ContainsAny(value, "vV") {
+		return false
+	}
+	c, ok := ParseLength(value)
+	return ok && usesViewport(c.root)
+}
+
+func usesViewport(node calcNode) bool {
+	switch n := node.(type) {
+	case calcValue:
+		switch strings.ToLower(n.unit) {
+		case "vw", "vh", "vmin", "vmax":
+			return true
+		}
+	case calcOp:
+		return usesViewport(n.left) || usesViewport(n.right)
+	case calcFunc:
+		for _, arg := range n.args {
+			if usesViewport(arg) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ViewportRelative reports whether the computed style of node or of its
+// descendants depends on the size of the viewport, once styles are applied.
+func ViewportRelative(node *model.Node) bool {
+	if node == nil {
+		return false
+	}
+	if node.Computed.ViewportRelative {
+		return true
+	}
+	for _, child := range node.Children {
+		if ViewportRelative(child) {
+			return true
+		}
+	}
+	return ViewportRelative(node.Before) || ViewportRelative(node.After) || ViewportRelative(node.Marker)
+}
+
+// isLinear reports whether an expression is a sum of lengths and
+// percentages, without min(), max() or clamp().
+func isLinear(node calcNode) bool {
+	switch n := node.(type) {
+	case calcOp:
+		return isLinear(n.left) && isLinear(n.right)
+	case calcFunc:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package css
+
+import (
+	"math"
+	"testing"
+)
+
+func TestComputedFontSize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+	}{
+		{"12px", 12},
+		{"2em", 20},
+		{"2rem", 40},
+		{"50%", 5},
+		{"calc(1em + 1rem)", 30},
+		{"10vw", 80},
+		{"12pt", 16},
+		{"large", 18},
+		{"larger", 12},
+		{"smaller", 10 / 1.2},
+		// invalid, so inherited
+		{"-1px", 10},
+		{"auto", 10},
+	}
+	for _, test := range tests {
+		doc := styleDocument(`<div style="font-size: 20px"><div style="font-size: 10px"><p id="p" style="font-size: ` + test.value + `">a</p></div></div>`)
+		if got := doc.GetElementByID("p").Computed.FontSize; got != test.want {
+			t.Errorf("font-size: %s = %vpx, want %vpx", test.value, got, test.want)
+		}
+	}
+}
+
+func TestRootFontSize(t *testing.T) {
+	doc := styleDocument(`<div id="root" style="font-size: 2rem; margin-top: 1rem"><p id="p" style="font-size: 1rem">a</p></div>`)
+	root, p := doc.GetElementByID("root"), doc.GetElementByID("p")
+	if got := root.Computed.FontSize; got != 32 {
+		t.Errorf("font-size: 2rem of the root = %vpx, want 32px", got)
+	}
+	// other properties of the root refer to its own font size
+	if got := root.Computed.Lengths["margin-top"].Px; got != 32 {
+		t.Errorf("margin-top: 1rem of the root = %vpx, want 32px", got)
+	}
+	if got := p.Computed.FontSize; got != 32 {
+		t.Errorf("font-size: 1rem = %vpx, want 32px", got)
+	}
+}
+
+func TestComputedLength(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64 // resolved with percentages of 400px
+		auto  bool
+	}{
+		{"10px", 10, false},
+		{"0", 0, false},
+		{"2em", 60, false},
+		{"2rem", 40, false},
+		{"2ex", 30, false},
+		{"2ch", 30, false},
+		{"10vw", 80, false},
+		{"10vh", 60, false},
+		{"10vmin", 60, false},
+		{"10vmax", 80, false},
+		{"72pt", 96, false},
+		{"6pc", 96, false},
+		{"1in", 96, false},
+		{"2.54cm", 96, false},
+		{"25.4mm", 96, false},
+		{"101.6q", 96, false},
+		{"50%", 200, false},
+		{"calc(50% - 1em)", 170, false},
+		{"min(50%, 100px)", 100, false},
+		{"auto", 0, true},
+	}
+	for _, test := range tests {
+		doc := styleDocument(`<div style="font-size: 20px"><p id="p" style="font-size: 30px; margin-left: ` + test.value + `">a</p></div>`)
+		got := doc.GetElementByID("p").Computed.Lengths["margin-left"]
+		if got.Auto != test.auto || math.Abs(got.Resolve(400)-test.want) > 1e-9 {
+			t.Errorf("margin-left: %s = %+v resolving to %v, want %v", test.value, got, got.Resolve(400), test.want)
+		}
+	}
+}
+
+func TestComputedBorderWidth(t *testing.T) {
+	doc := styleDocument(`<p id="p" style="border-width: thin medium thick 2px; border-style: solid solid solid none">a</p>`)
+	lengths := doc.GetElementByID("p").Computed.Lengths
+	for side, want := range map[string]float64{"top": 1, "right": 3, "bottom": 5, "left": 0} {
+		if got := lengths["border-"+side+"-width"].Px; got != want {
+			t.Errorf("border-%s-width = %vpx, want %vpx", side, got, want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package css
+
+import (
+	"strconv"
+	"strings"
+)
+
+// counterStyle is a predefined counter style.
+// https://www.w3.org/TR/css-counter-styles-3/#predefined-counters
+type counterStyle struct {
+	system  string // cyclic, alphabetic, additive or cjk
+	symbols []string
+	values  []int // weights of the symbols of additive styles
+	suffix  string
+}
+
+var counterStyles = map[string]counterStyle{
+	"disc":                 {system: "cyclic", symbols: []string{"•"}, suffix: " "},
+	"circle":               {system: "cyclic", symbols: []string{"◦"}, suffix: " "},
+	"square":               {system: "cyclic", symbols: []string{"▪"}, suffix: " "},
+	"disclosure-open":      {system: "cyclic", symbols: []string{"▾"}, suffix: " "},
+	"disclosure-closed":    {system: "cyclic", symbols: []string{"▸"}, suffix: " "},
+	"decimal":              {system: "numeric", suffix: ". "},
+	"decimal-leading-zero": {system: "numeric", suffix: ". "},
+	"lower-alpha":          {system: "alphabetic", symbols: strings.Split("abcdefghijklmnopqrstuvwxyz", ""), suffix: ". "},
+	"upper-alpha":          {system: "alphabetic", symbols: strings.Split("ABCDEFGHIJKLMNOPQRSTUVWXYZ", ""), suffix: ". "},
+	"lower-roman": {
+		system:  "additive",
+		symbols: []string{"m", "cm", "d", "cd", "c", "xc", "l", "xl", "x", "ix", "v", "iv", "i"},
+		values:  []int{1000, 900, 500, 400, 100, 90, 50, 40, 10, 9, 5, 4, 1},
+		suffix:  ". ",
+	},
+	"upper-roman": {
+		system:  "additive",
+		symbols: []string{"M", "CM", "D", "CD", "C", "XC", "L", "XL", "X", "IX", "V", "IV", "I"},
+		values:  []int{1000, 900, 500, 400, 100, 90, 50, 40, 10, 9, 5, 4, 1},
+		suffix:  ". ",
+	},
+	"cjk-ideographic": {system: "cjk", symbols: strings.Split("零一二三四五六七八九", ""), suffix: "、"},
+	"hiragana": {
+		system:  "alphabetic",
+		symbols: strings.Split("あいうえおかきくけこさしすせそたちつてとなにぬねのはひふへほまみむめもやゆよらりるれろわゐゑをん", ""),
+		suffix:  "、",
+	},
+	"katakana": {
+		system:  "alphabetic",
+		symbols: strings.Split("アイウエオカキクケコサシスセソタチツテトナニヌネノハヒフヘホマミムメモヤユヨラリルレロワヰヱヲン", ""),
+		suffix:  "、",
+	},
+}
+
+func init() {
+	counterStyles["lower-latin"] = counterStyles["lower-alpha"]
+	counterStyles["upper-latin"] = counterStyles["upper-alpha"]
+}
+
+// formatCounter represents value in the counter style name, like "iv" in
+// lower-roman. Unknown styles, and values a style cannot represent, fall
+// back to decimal.
+func formatCounter(value int, name string) string {
+	name = strings.ToLower(name)
+	if name == "none" {
+		return ""
+	}
+	style, ok := counterStyles[name]
+	if !ok {
+		return strconv.Itoa(value)
+	}
+	switch style.system {
+	case "cyclic":
+		return style.symbols[0]
+	case "alphabetic":
+		if value < 1 {
+			break
+		}
+		// bijective base, so that z is followed by aa
+		n := len(style.symbols)
+		ret := ""
+		for ; value > 0; value = (value - 1) / n {
+			ret = style.symbols[(value-1)%n] + ret
+		}
+		return ret
+	case "additive":
+		if value < 1 || value > 3999 {
+			break
+		}
+		var b strings.Builder
+		for i, weight := range style.values {
+			for ; value >= weight; value -= weight {
+				b.WriteString(style.symbols[i])
+			}
+		}
+		return b.String()
+	case "cjk":
+		if value < 0 || value > 9999 {
+			break
+		}
+		return cjkNumber(value, style.symbols)
+	}
+	if name == "decimal-leading-zero" && value >= 0 && value < 10 {
+		return "0" + strconv.Itoa(value)
+	}
+	return strconv.Itoa(value)
+}
+
+// cjkNumber writes value below 10000 with Chinese numerals, like 一百零五.
+// https://www.w3.org/TR/css-counter-styles-3/#limited-chinese
+func cjkNumber(value int, digits []string) string {
+	if value == 0 {
+		return digits[0]
+	}
+	units := []string{"千", "百", "十", ""}
+	ret := ""
+	zero := false
+	for i, weight := range []int{1000, 100, 10, 1} {
+		d := value / weight % 10
+		if d == 0 {
+			zero = ret != ""
+			continue
+		}
+		if zero {
+			ret += digits[0]
+			zero = false
+		}
+		// 十一 rather than 一十一 for 10 to 19
+		if !(weight == 10 && d == 1 && ret == "") {
+			ret += digits[d]
+		}
+		ret += units[i]
+	}
+	return ret
+}
+
+// markerText returns the text of a list marker for value in the counter
+// style name, with the suffix of the style.
+func markerText(value int, name string) string {
+	if strings.EqualFold(name, "none") {
+		return ""
+	}
+	suffix := ". "
+	if style, ok := counterStyles[strings.ToLower(name)]; ok {
+		suffix = style.suffix
+	}
+	return formatCounter(value, name) + suffix
+}
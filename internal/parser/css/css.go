@@ -1,250 +1,786 @@
 package css
 
 import (
-	"errors"
-	"strconv"
+	"sort"
 	"strings"
-	"unicode"
+	"unicode/utf8"
 
 	"github.com/pishiko/tenmusu/internal/parser/model"
 )
 
-var (
-	INHERITED_PROPERTIES = map[string]string{
-		"font-size":   "16px",
-		"font-style":  "normal",
-		"font-weight": "normal",
-		"color":       "black",
-	}
-)
-
+// CSSParser parses stylesheets following CSS Syntax Module Level 3.
+// https://www.w3.org/TR/css-syntax-3/#parsing
 type CSSParser struct {
-	s string
-	i int
+	s          string
+	tokens     []Token
+	i          int
+	lineStarts []int // offsets of the lines of s, computed on the first position
+
+	file        string
+	origin      Origin
+	diagnostics []model.Diagnostic
+
+	load      *ImportLoader
+	importing map[string]bool // sheets being imported, from the outermost one, to detect cycles
+	seenRule  bool            // whether a rule other than @charset and @import was found
 }
 
-func InlineCSSParse(s string) map[string]string {
-	parser := &CSSParser{
-		s: s,
-		i: 0,
+// ImportLoader fetches the stylesheets imported with @import.
+type ImportLoader struct {
+	// Resolve returns the location of url imported from the sheet at file,
+	// which becomes the file of the imported sheet.
+	Resolve func(file, url string) (string, bool)
+	// Load fetches the contents of the sheet at a resolved location.
+	Load func(location string) (string, bool)
+}
+
+func newCSSParser(file string, s string) *CSSParser {
+	p := &CSSParser{
+		s:    preprocess(s),
+		file: file,
+	}
+	tokenizer := NewTokenizer(p.s)
+	tokenizer.errors = func(offset int, code, message string) {
+		p.reportAt(offset, model.SeverityError, code, message)
 	}
-	return parser.body()
+	p.tokens = tokenizer.Tokenize()
+	return p
+}
+
+func InlineCSSParse(s string) []Declaration {
+	parser := newCSSParser("", s)
+	return parser.declarations(parser.componentValues())
 }
 
 func CSSParse(s string) []CSSRule {
-	parser := &CSSParser{
-		s: s,
-		i: 0,
+	rules, _ := CSSParseFile("", s, AuthorOrigin)
+	return rules
+}
+
+// CSSParseFile parses the stylesheet s loaded from file, and returns
+// the rules together with the problems found in it.
+func CSSParseFile(file string, s string, origin Origin) ([]CSSRule, []model.Diagnostic) {
+	return CSSParseFileWithImports(file, s, origin, nil)
+}
+
+// CSSParseFileWithImports is like CSSParseFile, but also loads the sheets
+// imported with @import through load. Their rules take the place of the
+// @import rules.
+func CSSParseFileWithImports(file string, s string, origin Origin, load *ImportLoader) ([]CSSRule, []model.Diagnostic) {
+	parser := newCSSParser(file, s)
+	parser.origin = origin
+	parser.load = load
+	parser.importing = map[string]bool{file: true}
+	rules := parser.parse()
+	return rules, parser.diagnostics
+}
+
+// ParseSelector parses a standalone selector list, as used by QuerySelector.
+func ParseSelector(s string) (Selector, error) {
+	parser := newCSSParser("", s)
+	selectors, err := parseSelectorList(parser.componentValues())
+	if err != nil {
+		return nil, err
+	}
+	if len(selectors) == 1 {
+		return selectors[0], nil
 	}
-	return parser.parse()
+	return &IsSelector{selectors: selectors}, nil
 }
 
-func (p *CSSParser) ignoreUntil(s string) rune {
-	for p.i < len(p.s) {
-		if contains(s, rune(p.s[p.i])) {
-			return rune(p.s[p.i])
+// position converts the byte offset i into a line and column.
+func (p *CSSParser) position(i int) model.Position {
+	if p.lineStarts == nil {
+		p.lineStarts = []int{0}
+		for j := 0; j < len(p.s); j++ {
+			if p.s[j] == '\n' {
+				p.lineStarts = append(p.lineStarts, j+1)
+			}
 		}
-		p.i++
 	}
-	return 0 // End of string
+	i = min(i, len(p.s))
+	// the last line starting at or before i
+	line := sort.Search(len(p.lineStarts), func(n int) bool { return p.lineStarts[n] > i })
+	return model.Position{
+		File:   p.file,
+		Line:   line,
+		Column: 1 + utf8.RuneCountInString(p.s[p.lineStarts[line-1]:i]),
+	}
 }
 
-func (p *CSSParser) skipSpaceAndComments() {
-	p.whitespace()
-	for ok := p.comment(); ok; ok = p.comment() {
-		p.whitespace()
-	}
+func (p *CSSParser) reportAt(offset int, severity model.Severity, code, message string) {
+	p.diagnostics = append(p.diagnostics, model.Diagnostic{
+		Severity: severity,
+		Code:     code,
+		Pos:      p.position(offset),
+		Message:  message,
+	})
 }
 
-func (p *CSSParser) whitespace() {
-	for p.i < len(p.s) && unicode.IsSpace(rune(p.s[p.i])) {
+func (p *CSSParser) next() Token {
+	token := p.tokens[p.i]
+	if token.Type != EOFToken {
 		p.i++
 	}
+	return token
 }
 
-func (p *CSSParser) comment() bool {
-	if p.i+1 < len(p.s) && p.s[p.i] == '/' && p.s[p.i+1] == '*' {
-		p.i += 2 // skip /*
-		for p.i+1 < len(p.s) && !(p.s[p.i] == '*' && p.s[p.i+1] == '/') {
-			p.i++
-		}
-		if p.i+1 < len(p.s) {
-			p.i += 2 // skip */
-			return true
-		} else {
-			println("[CSS PARSER] unterminated comment")
+func (p *CSSParser) reconsume() {
+	p.i--
+}
+
+// rawRule is a qualified rule or an at-rule before its prelude and block are interpreted.
+type rawRule struct {
+	atKeyword string // empty for qualified rules
+	prelude   []ComponentValue
+	block     *ComponentValue // nil for at-rules ending with a semicolon
+	offset    int
+}
+
+// rules consumes a list of rules.
+func (p *CSSParser) rules(topLevel bool) []rawRule {
+	rules := []rawRule{}
+	for {
+		token := p.next()
+		switch token.Type {
+		case WhitespaceToken:
+		case EOFToken:
+			return rules
+		case CDOToken, CDCToken:
+			if topLevel {
+				continue
+			}
+			p.reconsume()
+			if rule := p.qualifiedRule(); rule != nil {
+				rules = append(rules, *rule)
+			}
+		case AtKeywordToken:
+			p.reconsume()
+			rules = append(rules, p.atRule())
+		default:
+			p.reconsume()
+			if rule := p.qualifiedRule(); rule != nil {
+				rules = append(rules, *rule)
+			}
 		}
 	}
-	return false
 }
 
-func (p *CSSParser) word() string {
-	start := p.i
-	for p.i < len(p.s) {
-		r := rune(p.s[p.i])
-		if unicode.IsLetter(r) || unicode.IsDigit(r) || contains("#-.%", r) {
-			p.i++
-		} else {
-			break
+func (p *CSSParser) atRule() rawRule {
+	token := p.next()
+	rule := rawRule{atKeyword: strings.ToLower(token.Value), offset: token.Offset}
+	for {
+		token := p.next()
+		switch token.Type {
+		case SemicolonToken:
+			return rule
+		case EOFToken:
+			p.reportAt(token.Offset, model.SeverityError, "eof-in-rule", "unexpected end of file in @"+rule.atKeyword)
+			return rule
+		case LeftBraceToken:
+			block := p.simpleBlock(token)
+			rule.block = &block
+			return rule
+		default:
+			p.reconsume()
+			rule.prelude = append(rule.prelude, p.componentValue())
 		}
 	}
-	if start >= p.i {
-		println("[CSS PARSER] unexpected end of word", p.i)
-		// println(p.s, " at ", p.i)
-		return ""
-	}
-	return p.s[start:p.i]
 }
 
-func (p *CSSParser) literal(literal rune) {
-	if !(p.i < len(p.s) && rune(p.s[p.i]) == literal) {
-		print("[CSS PARSER] expected string literal ", string(literal))
-		if p.i < len(p.s) {
-			println(" but got ", string(p.s[p.i]))
-		} else {
-			println(" but got end of string")
+func (p *CSSParser) qualifiedRule() *rawRule {
+	rule := &rawRule{offset: p.tokens[p.i].Offset}
+	for {
+		token := p.next()
+		switch token.Type {
+		case EOFToken:
+			p.reportAt(token.Offset, model.SeverityError, "eof-in-rule", "unexpected end of file in rule")
+			return nil
+		case LeftBraceToken:
+			block := p.simpleBlock(token)
+			rule.block = &block
+			return rule
+		default:
+			p.reconsume()
+			rule.prelude = append(rule.prelude, p.componentValue())
 		}
 	}
-	p.i++
 }
 
-func (p *CSSParser) pair() (string, string, error) {
-	prop := p.word()
-	if prop == "" {
-		return "", "", errors.New("[CSS PARSER] expected property name")
+// componentValues consumes the rest of the input as component values.
+func (p *CSSParser) componentValues() []ComponentValue {
+	values := []ComponentValue{}
+	for p.tokens[p.i].Type != EOFToken {
+		values = append(values, p.componentValue())
 	}
-	p.skipSpaceAndComments()
-	p.literal(':')
-	p.skipSpaceAndComments()
-	value := p.word()
-	if value == "" {
-		return "", "", errors.New("[CSS PARSER] expected property value")
+	return values
+}
+
+func (p *CSSParser) componentValue() ComponentValue {
+	token := p.next()
+	switch token.Type {
+	case LeftBraceToken, LeftBracketToken, LeftParenToken:
+		return p.simpleBlock(token)
+	case FunctionToken:
+		return p.function(token)
 	}
-	return strings.ToLower(prop), value, nil
+	return ComponentValue{Token: token}
 }
 
-func (p *CSSParser) body() map[string]string {
-	pairs := make(map[string]string)
-	for p.i < len(p.s) && rune(p.s[p.i]) != '}' {
-		prop, value, err := p.pair()
-		if err != nil {
-			println("[CSS PARSER] Error parsing property:", err.Error())
-			why := p.ignoreUntil(";}")
-			if why == ';' {
-				p.literal(';')
+var closingTokens = map[TokenType]TokenType{
+	LeftBraceToken:   RightBraceToken,
+	LeftBracketToken: RightBracketToken,
+	LeftParenToken:   RightParenToken,
+	FunctionToken:    RightParenToken,
+}
+
+func (p *CSSParser) simpleBlock(open Token) ComponentValue {
+	block := ComponentValue{Token: open, Children: []ComponentValue{}}
+	for {
+		token := p.next()
+		switch token.Type {
+		case closingTokens[open.Type]:
+			return block
+		case EOFToken:
+			p.reportAt(token.Offset, model.SeverityError, "eof-in-block", "unexpected end of file in block")
+			return block
+		default:
+			p.reconsume()
+			block.Children = append(block.Children, p.componentValue())
+		}
+	}
+}
+
+func (p *CSSParser) function(open Token) ComponentValue {
+	return p.simpleBlock(open)
+}
+
+// Declaration is a property and its value in a declaration block.
+type Declaration struct {
+	Name      string
+	Value     []ComponentValue
+	Important bool
+	Pos       model.Position
+}
+
+// Text returns the value serialized as CSS text, with whitespace collapsed.
+func (d Declaration) Text() string {
+	return Serialize(d.Value)
+}
+
+// declarations interprets the contents of a declaration block, keeping
+// only the known properties with valid values, and expanding shorthands.
+func (p *CSSParser) declarations(values []ComponentValue) []Declaration {
+	return p.declarationList(values, true)
+}
+
+// descriptors interprets the contents of an at-rule block like
+// @font-face, whose descriptors are not properties and are checked by
+// the rule itself.
+func (p *CSSParser) descriptors(values []ComponentValue) []Declaration {
+	return p.declarationList(values, false)
+}
+
+func (p *CSSParser) declarationList(values []ComponentValue, validate bool) []Declaration {
+	ret := []Declaration{}
+	for i := 0; i < len(values); {
+		v := values[i]
+		switch {
+		case v.Is(WhitespaceToken), v.Is(SemicolonToken):
+			i++
+		case v.Is(AtKeywordToken):
+			p.reportAt(v.Token.Offset, model.SeverityWarning, "unexpected-at-rule", "unexpected @"+v.Token.Value+" in declarations")
+			for i < len(values) && !values[i].Is(SemicolonToken) && !values[i].Is(LeftBraceToken) {
+				i++
+			}
+			i++
+		case v.Is(IdentToken):
+			start := i
+			for i < len(values) && !values[i].Is(SemicolonToken) {
+				i++
+			}
+			decl, ok := p.declaration(values[start:i])
+			if !ok {
+				continue
+			}
+			if !validate {
+				ret = append(ret, decl)
+				continue
+			}
+			_, isShorthand := shorthands[decl.Name]
+			if _, ok := properties[decl.Name]; !ok && !isShorthand && !isCustomProperty(decl.Name) {
+				p.reportAt(values[start].Token.Offset, model.SeverityWarning, "unknown-property", "unknown property "+decl.Name)
+				continue
+			}
+			if containsVar(decl.Value) {
+				// values with var() are checked once substituted
+				ret = append(ret, decl)
+				continue
+			}
+			expanded, err := expandShorthand(decl)
+			if err != nil {
+				p.reportAt(values[start].Token.Offset, model.SeverityWarning, "invalid-declaration", err.Error())
+				continue
+			}
+			for _, d := range expanded {
+				if !validDeclaration(d) {
+					p.reportAt(values[start].Token.Offset, model.SeverityWarning, "invalid-declaration", "invalid value for "+d.Name)
+					continue
+				}
+				ret = append(ret, d)
+			}
+		default:
+			p.reportAt(v.Token.Offset, model.SeverityWarning, "invalid-declaration", "expected property name")
+			for i < len(values) && !values[i].Is(SemicolonToken) {
+				i++
 			}
-			continue
 		}
-		pairs[prop] = value
-		p.skipSpaceAndComments()
-		p.literal(';')
-		p.skipSpaceAndComments()
 	}
-	return pairs
+	return ret
+}
+
+func (p *CSSParser) declaration(values []ComponentValue) (Declaration, bool) {
+	name := values[0].Token
+	decl := Declaration{Name: name.Value, Pos: p.position(name.Offset)}
+	if !strings.HasPrefix(decl.Name, "--") {
+		decl.Name = strings.ToLower(decl.Name)
+	}
+	rest := trimWhitespace(values[1:])
+	if len(rest) == 0 || !rest[0].Is(ColonToken) {
+		p.reportAt(name.Offset, model.SeverityWarning, "invalid-declaration", "expected : after "+decl.Name)
+		return decl, false
+	}
+	value := trimWhitespace(rest[1:])
+	if n := len(value); n >= 2 && value[n-1].IsIdent("important") {
+		bang := trimWhitespace(value[:n-1])
+		if len(bang) > 0 && bang[len(bang)-1].IsDelim("!") {
+			decl.Important = true
+			value = trimWhitespace(bang[:len(bang)-1])
+		}
+	}
+	if len(value) == 0 && !strings.HasPrefix(decl.Name, "--") {
+		p.reportAt(name.Offset, model.SeverityWarning, "invalid-declaration", "expected property value for "+decl.Name)
+		return decl, false
+	}
+	decl.Value = value
+	return decl, true
 }
 
 type CSSRule struct {
-	Selector Selector
-	Body     map[string]string
+	// Selectors is the selector list of the rule. Each of them has its own specificity.
+	Selectors []Selector
+	Body      []Declaration
+	Origin    Origin
+	Pos       model.Position
+	// Media holds the conditions of the @media rules enclosing the rule.
+	// All of them must match for the rule to apply.
+	Media []MediaQueryList
+	// FontFace is set for @font-face rules, which have no selectors.
+	FontFace *FontFace
+}
+
+// MatchesMedia reports whether the media conditions of the rule hold in m.
+func (r CSSRule) MatchesMedia(m Media) bool {
+	for _, list := range r.Media {
+		if !list.Matches(m) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchMedia returns the rules that apply in the media m.
+func MatchMedia(rules []CSSRule, m Media) []CSSRule {
+	ret := []CSSRule{}
+	for _, rule := range rules {
+		if rule.MatchesMedia(m) {
+			ret = append(ret, rule)
+		}
+	}
+	return ret
+}
+
+// WithMedia returns rules applying only when list matches too, like the
+// rules of a <link> with a media attribute.
+func WithMedia(rules []CSSRule, list MediaQueryList) []CSSRule {
+	if len(list) == 0 {
+		return rules
+	}
+	ret := make([]CSSRule, len(rules))
+	for i, rule := range rules {
+		rule.Media = append([]MediaQueryList{list}, rule.Media...)
+		ret[i] = rule
+	}
+	return ret
+}
+
+// MediaChanged reports whether any of the rules applies in only one of a and b,
+// i.e. whether moving from a to b crosses a breakpoint.
+func MediaChanged(rules []CSSRule, a, b Media) bool {
+	for _, rule := range rules {
+		if len(rule.Media) > 0 && rule.MatchesMedia(a) != rule.MatchesMedia(b) {
+			return true
+		}
+	}
+	return false
 }
 
 func (p *CSSParser) parse() []CSSRule {
+	return p.ruleList(p.rules(true), nil)
+}
+
+// ruleList interprets raw rules found inside the media conditions media.
+func (p *CSSParser) ruleList(raws []rawRule, media []MediaQueryList) []CSSRule {
 	rules := []CSSRule{}
-	for p.i < len(p.s) {
-		p.skipSpaceAndComments()
-		selector, err := p.selector()
-		if err != nil {
-			println("[CSS PARSER] Error parsing selector:", err.Error())
-			why := p.ignoreUntil("}")
-			if why == '}' {
-				p.literal('}')
+	for _, raw := range raws {
+		if raw.atKeyword != "charset" && raw.atKeyword != "import" {
+			p.seenRule = true
+		}
+		switch raw.atKeyword {
+		case "":
+		case "charset":
+			continue
+		case "import":
+			if p.seenRule {
+				p.reportAt(raw.offset, model.SeverityWarning, "misplaced-import", "@import must come before other rules")
+				continue
+			}
+			rules = append(rules, p.importRule(raw, media)...)
+			continue
+		case "media":
+			if raw.block == nil {
+				p.reportAt(raw.offset, model.SeverityWarning, "invalid-at-rule", "expected block in @media")
+				continue
+			}
+			list := parseMediaQueryList(raw.prelude)
+			for _, q := range list {
+				if q.invalid {
+					p.reportAt(raw.offset, model.SeverityWarning, "invalid-media-query", "invalid media query in @media")
+					break
+				}
+			}
+			nested := append(media[:len(media):len(media)], list)
+			rules = append(rules, p.ruleList(p.nestedRules(raw.block.Children), nested)...)
+			continue
+		case "font-face":
+			if raw.block == nil {
+				p.reportAt(raw.offset, model.SeverityWarning, "invalid-at-rule", "expected block in @font-face")
+				continue
+			}
+			face, err := p.fontFace(raw)
+			if err != nil {
+				p.reportAt(raw.offset, model.SeverityWarning, "invalid-at-rule", err.Error())
+				continue
 			}
+			rules = append(rules, CSSRule{
+				Origin:   p.origin,
+				Pos:      face.Pos,
+				Media:    media,
+				FontFace: face,
+			})
+			continue
+		default:
+			p.reportAt(raw.offset, model.SeverityWarning, "unsupported-at-rule", "unsupported at-rule @"+raw.atKeyword)
 			continue
 		}
-		p.literal('{')
-		p.skipSpaceAndComments()
-		body := p.body()
-		p.literal('}')
-		rule := CSSRule{
-			Selector: selector,
-			Body:     body,
+		selectors, err := parseSelectorList(raw.prelude)
+		if err != nil {
+			p.reportAt(raw.offset, model.SeverityWarning, "invalid-selector", err.Error())
+			continue
 		}
-		rules = append(rules, rule)
+		rules = append(rules, CSSRule{
+			Selectors: selectors,
+			Body:      p.declarations(raw.block.Children),
+			Origin:    p.origin,
+			Pos:       p.position(raw.offset),
+			Media:     media,
+		})
 	}
 	return rules
 }
 
-func (p *CSSParser) selector() (Selector, error) {
-	ret := Selector(nil)
-	tag := p.word()
-	if tag == "" {
-		return nil, errors.New("[CSS PARSER] expected tag name")
+// importRule loads the sheet of an @import rule, and returns its rules.
+// https://www.w3.org/TR/css-cascade-4/#at-import
+func (p *CSSParser) importRule(raw rawRule, media []MediaQueryList) []CSSRule {
+	prelude := trimWhitespace(raw.prelude)
+	href, ok := "", false
+	if raw.block == nil && len(prelude) > 0 {
+		href, ok = importURL(prelude[0])
 	}
-	ret = &TagSelector{tag: strings.ToLower(tag)}
-	p.skipSpaceAndComments()
-	for p.i < len(p.s) && rune(p.s[p.i]) != '{' {
-		tag := p.word()
-		if tag == "" {
-			return nil, errors.New("[CSS PARSER] expected tag name")
+	if !ok {
+		p.reportAt(raw.offset, model.SeverityWarning, "invalid-at-rule", "expected url or string in @import")
+		return nil
+	}
+	rest := trimWhitespace(prelude[1:])
+	// cascade layers are not supported, the rules go to the importing layer
+	if len(rest) > 0 && (rest[0].IsIdent("layer") || rest[0].IsFunction() && strings.EqualFold(rest[0].Token.Value, "layer")) {
+		rest = rest[1:]
+	}
+	if list := parseMediaQueryList(rest); len(list) > 0 {
+		media = append(media[:len(media):len(media)], list)
+	}
+
+	if p.load == nil {
+		p.reportAt(raw.offset, model.SeverityWarning, "import-failed", "cannot load "+href)
+		return nil
+	}
+	file, ok := p.load.Resolve(p.file, href)
+	if !ok {
+		p.reportAt(raw.offset, model.SeverityWarning, "import-failed", "invalid location "+href)
+		return nil
+	}
+	// a cycle is detected before the sheet is fetched again
+	if p.importing[file] {
+		p.reportAt(raw.offset, model.SeverityWarning, "import-cycle", "import cycle through "+file)
+		return nil
+	}
+	s, ok := p.load.Load(file)
+	if !ok {
+		p.reportAt(raw.offset, model.SeverityWarning, "import-failed", "failed to load "+href)
+		return nil
+	}
+
+	child := newCSSParser(file, s)
+	child.origin = p.origin
+	child.load = p.load
+	child.importing = map[string]bool{file: true}
+	for f := range p.importing {
+		child.importing[f] = true
+	}
+	rules := child.ruleList(child.rules(true), media)
+	p.diagnostics = append(p.diagnostics, child.diagnostics...)
+	return rules
+}
+
+// importURL reads the location in @import, which is a url or a string.
+func importURL(v ComponentValue) (string, bool) {
+	switch {
+	case v.Is(URLToken), v.Is(StringToken):
+		return v.Token.Value, true
+	case v.IsFunction() && strings.EqualFold(v.Token.Value, "url"):
+		args := trimWhitespace(v.Children)
+		if len(args) == 1 && args[0].Is(StringToken) {
+			return args[0].Token.Value, true
 		}
-		decsendant := TagSelector{tag: strings.ToLower(tag)}
-		ret = &DescendantSelector{ancestor: ret, descendant: &decsendant}
-		p.skipSpaceAndComments()
 	}
-	return ret, nil
+	return "", false
 }
 
-func contains(s string, r rune) bool {
-	for _, c := range s {
-		if c == r {
-			return true
+// nestedRules consumes the contents of a block, like the one of @media, as a list of rules.
+func (p *CSSParser) nestedRules(values []ComponentValue) []rawRule {
+	tokens, i := p.tokens, p.i
+	defer func() {
+		p.tokens, p.i = tokens, i
+	}()
+	p.tokens, p.i = flatten(values, nil), 0
+	end := len(p.s)
+	if n := len(p.tokens); n > 0 {
+		end = p.tokens[n-1].Offset
+	}
+	p.tokens = append(p.tokens, Token{Type: EOFToken, Offset: end})
+	return p.rules(false)
+}
+
+// flatten turns component values back into the tokens they were consumed from.
+func flatten(values []ComponentValue, tokens []Token) []Token {
+	for _, v := range values {
+		tokens = append(tokens, v.Token)
+		if closing, ok := closingTokens[v.Token.Type]; ok {
+			tokens = flatten(v.Children, tokens)
+			tokens = append(tokens, Token{Type: closing, Offset: tokens[len(tokens)-1].Offset})
 		}
 	}
-	return false
+	return tokens
+}
+
+// ApplyStyle computes the style of node and its descendants from the
+// rules that apply in media.
+func ApplyStyle(node *model.Node, rules []CSSRule, media Media) {
+	rules = MatchMedia(rules, media)
+	applyStyle(node, nil, rules, media, map[string][]ComponentValue{}, newGenerator(rules))
+}
+
+// applyStyle computes the style of node and its descendants, and generates
+// the boxes of their pseudo-elements, given the custom properties
+// inherited from its parent. previous is the element or generated box
+// before node among the boxes of its parent, or nil.
+func applyStyle(node, previous *model.Node, rules []CSSRule, media Media, inherited map[string][]ComponentValue, g *generator) {
+	custom := computeNodeStyle(node, rules, media, inherited)
+	if node.Type == model.Element {
+		g.enter(node, previous)
+		node.Marker = nil
+		if isListItem(node) {
+			node.Marker = g.marker(node, rules, media, custom)
+		}
+		node.Before = g.pseudoElement(node, "before", nil, rules, media, custom)
+	}
+	previous = node.Before
+	for _, child := range node.Children {
+		applyStyle(child, previous, rules, media, custom, g)
+		if child.Type == model.Element {
+			previous = child
+		}
+	}
+	if node.Type == model.Element {
+		node.After = g.pseudoElement(node, "after", previous, rules, media, custom)
+	}
 }
 
-func ApplyStyle(node *model.Node, rules []CSSRule) {
-	// init
-	if node.Style == nil {
-		node.Style = make(map[string]string)
+// computeNodeStyle computes the style of node alone, and returns its
+// custom properties for its children to inherit.
+func computeNodeStyle(node *model.Node, rules []CSSRule, media Media, inherited map[string][]ComponentValue) map[string][]ComponentValue {
+	if node.Type != model.Element && node.Parent != nil {
+		// text has no declarations of its own, so it shares the style of its
+		// parent, of which layout only reads the inherited properties
+		node.Style = node.Parent.Style
+		node.Computed = node.Parent.Computed
+		return inherited
 	}
-	// inherited properties
-	for prop, defaultValue := range INHERITED_PROPERTIES {
-		if node.Parent != nil {
-			node.Style[prop] = node.Parent.Style[prop]
+
+	// every property starts inherited or initial
+	node.Style = make(map[string]string, len(properties))
+	for name, p := range properties {
+		if p.inherited && node.Parent != nil {
+			node.Style[name] = node.Parent.Style[name]
 		} else {
-			node.Style[prop] = defaultValue
+			node.Style[name] = p.initial
 		}
 	}
 
-	// sheet
-	for _, rule := range rules {
-		if !rule.Selector.Matches(node) {
+	// sheets and the style attribute, from the lowest precedence
+	decls := cascade(node, rules)
+	custom := customProperties(decls, inherited)
+	for name, value := range custom {
+		node.Style[name] = Serialize(value)
+	}
+	lookup := func(name string) ([]ComponentValue, bool) {
+		value, ok := custom[name]
+		return value, ok
+	}
+	origins := originValues{}
+	for _, c := range decls {
+		if isCustomProperty(c.decl.Name) {
 			continue
 		}
-		for property, value := range rule.Body {
-			node.Style[property] = value
+		origins.save(node, c)
+		value, ok := substitute(c.decl.Value, lookup)
+		value = trimWhitespace(value)
+		if !ok || len(value) == 0 {
+			// invalid at computed-value time, the property is unset
+			unsetProperty(node, c.decl.Name)
+			continue
+		}
+		decl := c.decl
+		decl.Value = value
+		expanded, err := expandShorthand(decl)
+		if err != nil {
+			unsetProperty(node, c.decl.Name)
+			continue
+		}
+		for _, d := range expanded {
+			items := nonWhitespace(d.Value)
+			switch {
+			case len(items) == 1 && items[0].IsIdent("revert"):
+				origins.revert(node, d.Name, c.origin)
+			case isCSSWideKeyword(items):
+				defaultProperty(node, d.Name, strings.ToLower(items[0].Token.Value))
+			case validDeclaration(d):
+				node.Style[d.Name] = Serialize(d.Value)
+			default:
+				unsetProperty(node, d.Name)
+			}
 		}
 	}
-	// inline
-	if styleText, ok := node.Attrs["style"]; ok {
-		node.Style = InlineCSSParse(styleText)
-	}
 
-	// font-size
-	if strings.HasSuffix(node.Style["font-size"], "%") {
-		parentSize := INHERITED_PROPERTIES["font-size"]
-		if node.Parent != nil {
-			parentSize = node.Parent.Style["font-size"]
+	computeStyle(node, media)
+	return custom
+}
+
+// originValues keeps the values of the longhands of an element before
+// the declarations of the user and author origins apply, which revert
+// rolls back to. Only the properties those origins declare are kept.
+type originValues [AuthorOrigin + 1]map[string]string
+
+// save keeps the values the declaration c is about to replace, for each
+// origin above the ones it belongs to, unless they are already kept.
+func (o *originValues) save(node *model.Node, c cascadedDeclaration) {
+	for origin := UserOrigin; origin <= AuthorOrigin; origin++ {
+		// important declarations come after all normal ones
+		if c.origin < origin && !c.decl.Important {
+			continue
+		}
+		if o[origin] == nil {
+			o[origin] = map[string]string{}
+		}
+		for _, name := range longhandsOf(c.decl.Name) {
+			if _, ok := o[origin][name]; !ok {
+				o[origin][name] = node.Style[name]
+			}
 		}
-		fs, _ := strings.CutSuffix(node.Style["font-size"], "%")
-		nodePct, _ := strconv.Atoi(fs)
-		parentPx, _ := strconv.Atoi(strings.TrimSuffix(parentSize, "px"))
-		node.Style["font-size"] = strconv.Itoa((parentPx*nodePct)/100) + "px"
 	}
+}
 
-	// children
-	for i := range node.Children {
-		ApplyStyle(node.Children[i], rules)
+// revert rolls a longhand back to its value from the origins below origin,
+// or unsets it in the user agent origin.
+// https://www.w3.org/TR/css-cascade-4/#default
+func (o *originValues) revert(node *model.Node, name string, origin Origin) {
+	if origin == UserAgentOrigin {
+		defaultProperty(node, name, "unset")
+		return
+	}
+	if value, ok := o[origin][name]; ok {
+		node.Style[name] = value
+	}
+}
+
+// longhandsOf returns the longhands a property sets, which is the property
+// itself for a longhand.
+func longhandsOf(name string) []string {
+	s, ok := shorthands[name]
+	if !ok {
+		return []string{name}
+	}
+	ret := []string{}
+	for _, longhand := range s.longhands {
+		ret = append(ret, longhandsOf(longhand)...)
+	}
+	return ret
+}
+
+// unsetProperty resets a property, or the longhands of a shorthand, to
+// the inherited value for inherited properties, or to the initial value.
+func unsetProperty(node *model.Node, name string) {
+	for _, longhand := range longhandsOf(name) {
+		defaultProperty(node, longhand, "unset")
+	}
+}
+
+// defaultProperty applies inherit, initial or unset to a longhand.
+// https://www.w3.org/TR/css-cascade-4/#defaulting-keywords
+func defaultProperty(node *model.Node, name, keyword string) {
+	p, ok := properties[name]
+	if !ok {
+		return
+	}
+	inherit := keyword == "inherit" || keyword != "initial" && p.inherited
+	if inherit && node.Parent != nil {
+		node.Style[name] = node.Parent.Style[name]
+	} else {
+		node.Style[name] = p.initial
+	}
+}
+
+// rootFontSize returns the font size rem refers to, the one of the root
+// element, or the initial one for the root element itself.
+func rootFontSize(node *model.Node) float64 {
+	var root *model.Node
+	for n := node.Parent; n != nil; n = n.Parent {
+		if n.Type == model.Element {
+			root = n
+		}
+	}
+	if root == nil {
+		return fontSizeKeywords["medium"]
 	}
+	return root.Computed.FontSize
 }
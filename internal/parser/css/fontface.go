@@ -0,0 +1,296 @@
+package css
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/pishiko/tenmusu/internal/parser/model"
+)
+
+// FontFace describes a font defined with @font-face.
+// https://www.w3.org/TR/css-fonts-4/#font-face-rule
+type FontFace struct {
+	Family       string
+	Sources      []FontSource
+	Weight       [2]int     // range of weights the face covers, like [100, 900] for a variable font
+	Style        string     // normal, italic or oblique
+	Oblique      [2]float64 // range of oblique angles in degrees, when Style is oblique
+	UnicodeRange [][2]rune  // ranges of characters the face covers, nil for all
+	Pos          model.Position
+}
+
+// FontSource is an entry of the src descriptor.
+type FontSource struct {
+	URL    string // empty for local fonts
+	Local  string // name of a font installed locally
+	Format string // empty when unknown
+}
+
+// FontFaces returns the fonts defined in rules whose media conditions hold in m.
+func FontFaces(rules []CSSRule, m Media) []FontFace {
+	ret := []FontFace{}
+	for _, rule := range rules {
+		if rule.FontFace != nil && rule.MatchesMedia(m) {
+			ret = append(ret, *rule.FontFace)
+		}
+	}
+	return ret
+}
+
+// Covers reports whether all characters of s are in the unicode-range of the face.
+func (f FontFace) Covers(s string) bool {
+	if f.UnicodeRange == nil {
+		return true
+	}
+	for _, r := range s {
+		covered := false
+		for _, rng := range f.UnicodeRange {
+			if r >= rng[0] && r <= rng[1] {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// fontFace interprets the descriptors of @font-face.
+func (p *CSSParser) fontFace(raw rawRule) (*FontFace, error) {
+	face := &FontFace{
+		Weight: [2]int{400, 400},
+		Style:  "normal",
+		Pos:    p.position(raw.offset),
+	}
+	for _, decl := range p.descriptors(raw.block.Children) {
+		// an invalid descriptor is ignored, and the previous value stays
+		next := *face
+		var err error
+		switch decl.Name {
+		case "font-family":
+			next.Family, err = familyName(decl.Value)
+		case "src":
+			next.Sources, err = fontSources(decl.Value)
+		case "font-weight":
+			next.Weight, err = fontWeightRange(decl.Value)
+		case "font-style":
+			next.Style, next.Oblique, err = fontStyleRange(decl.Value)
+		case "unicode-range":
+			next.UnicodeRange, err = unicodeRanges(decl.Value)
+		}
+		if err != nil {
+			p.reportAt(raw.offset, model.SeverityWarning, "invalid-descriptor", err.Error()+" in @font-face")
+			continue
+		}
+		*face = next
+	}
+	if face.Family == "" || len(face.Sources) == 0 {
+		return nil, errors.New("@font-face needs font-family and src")
+	}
+	return face, nil
+}
+
+// familyName reads a family name, which is a string or a sequence of identifiers.
+func familyName(values []ComponentValue) (string, error) {
+	values = trimWhitespace(values)
+	if len(values) == 1 && values[0].Is(StringToken) {
+		return values[0].Token.Value, nil
+	}
+	names := []string{}
+	for _, v := range values {
+		switch {
+		case v.Is(IdentToken):
+			names = append(names, v.Token.Value)
+		case !v.Is(WhitespaceToken):
+			return "", errors.New("invalid font-family")
+		}
+	}
+	if len(names) == 0 {
+		return "", errors.New("invalid font-family")
+	}
+	return strings.Join(names, " "), nil
+}
+
+func fontSources(values []ComponentValue) ([]FontSource, error) {
+	ret := []FontSource{}
+	for _, part := range splitByComma(values) {
+		part = nonWhitespace(part)
+		if len(part) == 0 {
+			return nil, errors.New("invalid src")
+		}
+		source := FontSource{}
+		if part[0].IsFunction() && strings.EqualFold(part[0].Token.Value, "local") {
+			name, err := familyName(part[0].Children)
+			if err != nil {
+				continue
+			}
+			source.Local = name
+			ret = append(ret, source)
+			continue
+		}
+		url, ok := importURL(part[0])
+		if !ok || part[0].Is(StringToken) {
+			continue
+		}
+		source.URL = url
+		for _, v := range part[1:] {
+			if v.IsFunction() && strings.EqualFold(v.Token.Value, "format") {
+				if args := nonWhitespace(v.Children); len(args) == 1 && (args[0].Is(StringToken) || args[0].Is(IdentToken)) {
+					source.Format = strings.ToLower(args[0].Token.Value)
+				}
+			}
+		}
+		ret = append(ret, source)
+	}
+	if len(ret) == 0 {
+		return nil, errors.New("invalid src")
+	}
+	return ret, nil
+}
+
+// FontWeight returns the numeric value of a font-weight keyword or number.
+func FontWeight(s string) (int, bool) {
+	switch strings.ToLower(s) {
+	case "normal":
+		return 400, true
+	case "bold":
+		return 700, true
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 1 || n > 1000 {
+		return 0, false
+	}
+	return int(n), true
+}
+
+func fontWeightRange(values []ComponentValue) ([2]int, error) {
+	values = nonWhitespace(values)
+	weights := []int{}
+	for _, v := range values {
+		if v.IsIdent("auto") && len(values) == 1 {
+			return [2]int{1, 1000}, nil
+		}
+		w, ok := FontWeight(v.String())
+		if !ok {
+			return [2]int{}, errors.New("invalid font-weight")
+		}
+		weights = append(weights, w)
+	}
+	switch len(weights) {
+	case 1:
+		return [2]int{weights[0], weights[0]}, nil
+	case 2:
+		return [2]int{min(weights[0], weights[1]), max(weights[0], weights[1])}, nil
+	}
+	return [2]int{}, errors.New("invalid font-weight")
+}
+
+// DefaultObliqueAngle is the angle in degrees of oblique without one.
+const DefaultObliqueAngle = 14
+
+// fontStyleRange parses the font-style descriptor, like "italic" or
+// "oblique 10deg 20deg", and returns the range of oblique angles.
+func fontStyleRange(values []ComponentValue) (string, [2]float64, error) {
+	values = nonWhitespace(values)
+	invalid := errors.New("invalid font-style")
+	if len(values) == 0 || !values[0].Is(IdentToken) {
+		return "", [2]float64{}, invalid
+	}
+	style := strings.ToLower(values[0].Token.Value)
+	switch style {
+	case "auto", "normal", "italic":
+		if len(values) > 1 {
+			return "", [2]float64{}, invalid
+		}
+		if style == "auto" {
+			style = "normal"
+		}
+		return style, [2]float64{}, nil
+	case "oblique":
+	default:
+		return "", [2]float64{}, invalid
+	}
+	if len(values) == 1 {
+		return style, [2]float64{DefaultObliqueAngle, DefaultObliqueAngle}, nil
+	}
+	angles := []float64{}
+	for _, v := range values[1:] {
+		var c *Calc
+		if v.Is(DimensionToken) {
+			root, typ, err := parseCalcValue(v)
+			if err != nil {
+				return "", [2]float64{}, invalid
+			}
+			c = &Calc{root: root, typ: typ}
+		} else if IsMathFunction(v) {
+			var err error
+			if c, err = ParseCalc(v); err != nil {
+				return "", [2]float64{}, invalid
+			}
+		}
+		if c == nil || c.typ != angleType {
+			return "", [2]float64{}, invalid
+		}
+		angle := c.Resolve(initialLengthContext)
+		if angle < -90 || angle > 90 {
+			return "", [2]float64{}, invalid
+		}
+		angles = append(angles, angle)
+	}
+	switch len(angles) {
+	case 1:
+		return style, [2]float64{angles[0], angles[0]}, nil
+	case 2:
+		return style, [2]float64{min(angles[0], angles[1]), max(angles[0], angles[1])}, nil
+	}
+	return "", [2]float64{}, invalid
+}
+
+// unicodeRanges parses the value of unicode-range, like "U+0000-00FF, U+4??".
+// There is no token for ranges, so the tokens of each range are put back
+// together as they were written: U+00E9 is an ident and a number with an
+// exponent, and U+0-7F an ident, a number and a dimension.
+// https://www.w3.org/TR/css-syntax-3/#urange-syntax
+func unicodeRanges(values []ComponentValue) ([][2]rune, error) {
+	ret := [][2]rune{}
+	for _, part := range splitByComma(values) {
+		part = trimWhitespace(part)
+		var b strings.Builder
+		for _, v := range part {
+			switch {
+			case v.Is(IdentToken), v.Is(DelimToken):
+				b.WriteString(v.Token.Value)
+			case v.Is(NumberToken):
+				b.WriteString(v.Token.Repr)
+			case v.Is(DimensionToken):
+				b.WriteString(v.Token.Repr + v.Token.Unit)
+			default:
+				return nil, errors.New("invalid unicode-range")
+			}
+		}
+		text := b.String()
+		if len(text) < 3 || !strings.EqualFold(text[:2], "u+") {
+			return nil, errors.New("invalid unicode-range")
+		}
+		text = text[2:]
+		var start, end string
+		if before, after, ok := strings.Cut(text, "-"); ok {
+			start, end = before, after
+		} else if strings.Contains(text, "?") {
+			start = strings.ReplaceAll(text, "?", "0")
+			end = strings.ReplaceAll(text, "?", "F")
+		} else {
+			start, end = text, text
+		}
+		first, err1 := strconv.ParseUint(start, 16, 32)
+		last, err2 := strconv.ParseUint(end, 16, 32)
+		if err1 != nil || err2 != nil || len(start) > 6 || len(end) > 6 || first > last {
+			return nil, errors.New("invalid unicode-range")
+		}
+		ret = append(ret, [2]rune{rune(first), rune(min(last, 0x10ffff))})
+	}
+	return ret, nil
+}
@@ -0,0 +1,87 @@
+package css
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFontFaceDescriptors(t *testing.T) {
+	rules, diagnostics := CSSParseFile("", `@font-face{font-family:Foo;src:url(a.woff2) format("woff2");font-weight:100 900;unicode-range:U+0000-00FF}`, AuthorOrigin)
+	if len(diagnostics) != 0 {
+		t.Errorf("diagnostics = %v, want none", diagnostics)
+	}
+	faces := FontFaces(rules, Media{Type: "screen"})
+	if len(faces) != 1 {
+		t.Fatalf("got %d faces, want 1", len(faces))
+	}
+	face := faces[0]
+	if face.Family != "Foo" {
+		t.Errorf("Family = %q, want Foo", face.Family)
+	}
+	if want := []FontSource{{URL: "a.woff2", Format: "woff2"}}; !reflect.DeepEqual(face.Sources, want) {
+		t.Errorf("Sources = %v, want %v", face.Sources, want)
+	}
+	if want := [2]int{100, 900}; face.Weight != want {
+		t.Errorf("Weight = %v, want %v", face.Weight, want)
+	}
+	if want := [][2]rune{{0, 0xFF}}; !reflect.DeepEqual(face.UnicodeRange, want) {
+		t.Errorf("UnicodeRange = %v, want %v", face.UnicodeRange, want)
+	}
+}
+
+func TestUnicodeRange(t *testing.T) {
+	tests := []struct {
+		value string
+		want  [][2]rune
+	}{
+		{"U+0-7F", [][2]rune{{0, 0x7F}}},
+		{"U+4??", [][2]rune{{0x400, 0x4FF}}},
+		// an ident followed by a number with an exponent
+		{"U+00E9", [][2]rune{{0xE9, 0xE9}}},
+		{"u+1e5-1e9", [][2]rune{{0x1E5, 0x1E9}}},
+		{"U+0025-00FF, U+4??, u+a", [][2]rune{{0x25, 0xFF}, {0x400, 0x4FF}, {0xA, 0xA}}},
+		{"U+10FFFF", [][2]rune{{0x10FFFF, 0x10FFFF}}},
+		{"U+7F-0", nil},
+		{"U+1234567", nil},
+		{"U+ 41", nil},
+		{"41", nil},
+	}
+	for _, test := range tests {
+		rules := CSSParse("@font-face { font-family: F; src: url(f.woff2); unicode-range: " + test.value + " }")
+		faces := FontFaces(rules, Media{})
+		if len(faces) != 1 {
+			t.Fatalf("%q: got %d faces", test.value, len(faces))
+		}
+		if !reflect.DeepEqual(faces[0].UnicodeRange, test.want) {
+			t.Errorf("%q: UnicodeRange = %v, want %v", test.value, faces[0].UnicodeRange, test.want)
+		}
+	}
+}
+
+func TestFontStyleDescriptor(t *testing.T) {
+	tests := []struct {
+		value   string
+		style   string
+		oblique [2]float64
+	}{
+		{"italic", "italic", [2]float64{}},
+		{"oblique", "oblique", [2]float64{14, 14}},
+		{"oblique 10deg", "oblique", [2]float64{10, 10}},
+		{"oblique 20deg -5deg", "oblique", [2]float64{-5, 20}},
+		{"oblique 0.25turn", "oblique", [2]float64{90, 90}},
+		// invalid values leave the default
+		{"oblique 100deg", "normal", [2]float64{}},
+		{"oblique 10px", "normal", [2]float64{}},
+		{"italic 10deg", "normal", [2]float64{}},
+	}
+	for _, test := range tests {
+		rules := CSSParse("@font-face { font-family: F; src: url(f.woff2); font-style: " + test.value + " }")
+		faces := FontFaces(rules, Media{})
+		if len(faces) != 1 {
+			t.Fatalf("%q: got %d faces", test.value, len(faces))
+		}
+		if faces[0].Style != test.style || faces[0].Oblique != test.oblique {
+			t.Errorf("%q: got %s %v, want %s %v", test.value, faces[0].Style, faces[0].Oblique, test.style, test.oblique)
+		}
+	}
+}
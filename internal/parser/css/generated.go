@@ -0,0 +1,302 @@
+package css
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/pishiko/tenmusu/internal/parser/model"
+)
+
+// Generated content, counters and quotes.
+// https://www.w3.org/TR/css-content-3/
+// https://www.w3.org/TR/css-lists-3/#auto-numbering
+
+// counter is an instance of a CSS counter.
+type counter struct {
+	name  string
+	owner *model.Node // the element that instantiated it
+	value int
+}
+
+// counterSet is the counters in scope for an element, the innermost last.
+type counterSet []counter
+
+// innermost returns the index of the innermost counter named name, or -1.
+func (s counterSet) innermost(name string) int {
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// instantiate creates a counter on node, which replaces the one a previous
+// sibling created with the same name.
+func (s counterSet) instantiate(node *model.Node, name string, value int) counterSet {
+	if i := s.innermost(name); i >= 0 && s[i].owner.Parent == node.Parent {
+		s = append(s[:i:i], s[i+1:]...)
+	}
+	return append(s, counter{name: name, owner: node, value: value})
+}
+
+// generator carries what generated content depends on through the
+// document in tree order.
+type generator struct {
+	counters   map[*model.Node]counterSet
+	last       counterSet // of the element immediately preceding in tree order
+	quoteDepth int
+	// pseudo are the pseudo-elements some rule selects, so that the others are not styled at all.
+	pseudo map[string]bool
+}
+
+func newGenerator(rules []CSSRule) *generator {
+	g := &generator{
+		counters: map[*model.Node]counterSet{},
+		pseudo:   map[string]bool{},
+	}
+	for _, rule := range rules {
+		for _, s := range rule.Selectors {
+			if pseudo, ok := s.(*PseudoElementSelector); ok {
+				g.pseudo[pseudo.name] = true
+			}
+		}
+	}
+	return g
+}
+
+// enter computes the counters of node from its parent and previous, the
+// element or generated box before it among the boxes of its parent, if
+// any. Then it applies counter-reset, counter-increment and counter-set.
+// https://www.w3.org/TR/css-lists-3/#creating-a-counter
+func (g *generator) enter(node, previous *model.Node) {
+	source := g.counters[node.Parent]
+	if previous != nil {
+		source = g.counters[previous]
+	}
+	set := append(counterSet{}, source...)
+	for i := range set {
+		for _, c := range g.last {
+			if c.name == set[i].name && c.owner == set[i].owner {
+				set[i].value = c.value
+			}
+		}
+	}
+
+	for _, c := range counterValues(node.Style["counter-reset"], 0) {
+		set = set.instantiate(node, c.name, c.value)
+	}
+	increments := counterValues(node.Style["counter-increment"], 1)
+	if isListItem(node) && !slices.ContainsFunc(increments, func(c counter) bool { return c.name == "list-item" }) {
+		// list items count themselves unless told otherwise
+		increments = append(increments, counter{name: "list-item", value: 1})
+	}
+	for _, c := range increments {
+		i := set.innermost(c.name)
+		if i < 0 {
+			set = set.instantiate(node, c.name, 0)
+			i = len(set) - 1
+		}
+		set[i].value += c.value
+	}
+	for _, c := range counterValues(node.Style["counter-set"], 0) {
+		i := set.innermost(c.name)
+		if i < 0 {
+			set = set.instantiate(node, c.name, 0)
+			i = len(set) - 1
+		}
+		set[i].value = c.value
+	}
+	g.counters[node] = set
+	g.last = set
+}
+
+// counterValues reads the value of counter-reset, counter-increment or
+// counter-set, where a counter without an integer takes value.
+func counterValues(s string, value int) []counter {
+	items := nonWhitespace(valuesOf(s))
+	ret := []counter{}
+	for i, item := range items {
+		switch {
+		case item.IsIdent("none"):
+		case item.Is(IdentToken):
+			ret = append(ret, counter{name: item.Token.Value, value: value})
+		case item.Is(NumberToken) && i > 0 && items[i-1].Is(IdentToken):
+			ret[len(ret)-1].value = int(item.Token.Number)
+		}
+	}
+	return ret
+}
+
+// isListItem reports whether node is displayed as a list item, with a marker.
+func isListItem(node *model.Node) bool {
+	return slices.ContainsFunc(nonWhitespace(valuesOf(node.Style["display"])), func(v ComponentValue) bool {
+		return v.IsIdent("list-item")
+	})
+}
+
+// newPseudoElement creates the box of pseudo-element name for node and
+// computes its style.
+func newPseudoElement(node *model.Node, name string, rules []CSSRule, media Media, inherited map[string][]ComponentValue) (*model.Node, map[string][]ComponentValue) {
+	pseudo := &model.Node{
+		Type:   model.Element,
+		Value:  "::" + name,
+		Parent: node,
+		Attrs:  map[string]string{},
+		Pseudo: name,
+	}
+	return pseudo, computeNodeStyle(pseudo, rules, media, inherited)
+}
+
+// setText makes text the only child of a generated box.
+func setText(pseudo *model.Node, text string, rules []CSSRule, media Media, custom map[string][]ComponentValue) {
+	child := &model.Node{
+		Type:   model.Text,
+		Value:  text,
+		Parent: pseudo,
+	}
+	pseudo.Children = []*model.Node{child}
+	computeNodeStyle(child, rules, media, custom)
+}
+
+// pseudoElement generates the box of pseudo-element name for node, after
+// previous among its boxes, or returns nil when it has no content.
+func (g *generator) pseudoElement(node *model.Node, name string, previous *model.Node, rules []CSSRule, media Media, inherited map[string][]ComponentValue) *model.Node {
+	if !g.pseudo[name] {
+		return nil
+	}
+	pseudo, custom := newPseudoElement(node, name, rules, media, inherited)
+	content := nonWhitespace(valuesOf(pseudo.Style["content"]))
+	// normal computes to none on ::before and ::after
+	if one(keywords("normal", "none"))(content) || strings.EqualFold(pseudo.Style["display"], "none") {
+		return nil
+	}
+	g.enter(pseudo, previous)
+	setText(pseudo, g.content(pseudo, content), rules, media, custom)
+	return pseudo
+}
+
+// marker generates the ::marker box of a list item, from its content or
+// else from list-style-type, or returns nil when it has none.
+// https://www.w3.org/TR/css-lists-3/#content-property
+func (g *generator) marker(node *model.Node, rules []CSSRule, media Media, inherited map[string][]ComponentValue) *model.Node {
+	marker, custom := newPseudoElement(node, "marker", rules, media, inherited)
+	// the marker comes first among the boxes of the list item
+	g.enter(marker, nil)
+	content := nonWhitespace(valuesOf(marker.Style["content"]))
+	text := ""
+	switch {
+	case one(keywords("none"))(content):
+	case !one(keywords("normal"))(content):
+		text = g.content(marker, content)
+	default:
+		// list-style-image is not drawn, so the type always stands for it
+		style := nonWhitespace(valuesOf(marker.Style["list-style-type"]))
+		if len(style) == 1 && style[0].Is(StringToken) {
+			text = style[0].Token.Value
+			break
+		}
+		set := g.counters[marker]
+		value := 0
+		if i := set.innermost("list-item"); i >= 0 {
+			value = set[i].value
+		}
+		text = markerText(value, marker.Style["list-style-type"])
+	}
+	if text == "" {
+		return nil
+	}
+	setText(marker, text, rules, media, custom)
+	return marker
+}
+
+// content evaluates the items of the content property of a generated box.
+func (g *generator) content(node *model.Node, items []ComponentValue) string {
+	var b strings.Builder
+	for _, item := range items {
+		switch {
+		case item.Is(StringToken):
+			b.WriteString(item.Token.Value)
+		case item.IsIdent("open-quote"), item.IsIdent("no-open-quote"):
+			if quotes := quotePairs(node.Style["quotes"]); len(quotes) > 0 && item.IsIdent("open-quote") {
+				b.WriteString(quotes[min(g.quoteDepth, len(quotes)-1)][0])
+			}
+			g.quoteDepth++
+		case item.IsIdent("close-quote"), item.IsIdent("no-close-quote"):
+			if g.quoteDepth == 0 {
+				continue
+			}
+			g.quoteDepth--
+			if quotes := quotePairs(node.Style["quotes"]); len(quotes) > 0 && item.IsIdent("close-quote") {
+				b.WriteString(quotes[min(g.quoteDepth, len(quotes)-1)][1])
+			}
+		case item.IsFunction():
+			b.WriteString(g.contentFunction(node, item))
+		}
+	}
+	return b.String()
+}
+
+// contentFunction evaluates attr(), counter() and counters().
+func (g *generator) contentFunction(node *model.Node, f ComponentValue) string {
+	args := splitByComma(f.Children)
+	for i := range args {
+		args[i] = nonWhitespace(args[i])
+	}
+	if len(args[0]) != 1 || !args[0][0].Is(IdentToken) {
+		return ""
+	}
+	name := args[0][0].Token.Value
+	switch strings.ToLower(f.Token.Value) {
+	case "attr":
+		// the attribute of the element the box is generated for
+		return node.Parent.Attrs[strings.ToLower(name)]
+	case "counter":
+		style := "decimal"
+		if len(args) > 1 && len(args[1]) == 1 && args[1][0].Is(IdentToken) {
+			style = args[1][0].Token.Value
+		}
+		set := g.counters[node]
+		value := 0
+		if i := set.innermost(name); i >= 0 {
+			value = set[i].value
+		}
+		return formatCounter(value, style)
+	case "counters":
+		if len(args) < 2 || len(args[1]) != 1 || !args[1][0].Is(StringToken) {
+			return ""
+		}
+		style := "decimal"
+		if len(args) > 2 && len(args[2]) == 1 && args[2][0].Is(IdentToken) {
+			style = args[2][0].Token.Value
+		}
+		values := []string{}
+		for _, c := range g.counters[node] {
+			if c.name == name {
+				values = append(values, formatCounter(c.value, style))
+			}
+		}
+		if len(values) == 0 {
+			values = append(values, formatCounter(0, style))
+		}
+		return strings.Join(values, args[1][0].Token.Value)
+	}
+	return ""
+}
+
+// quotePairs reads the quotes property into its open and close quotes,
+// from the outermost level.
+func quotePairs(s string) [][2]string {
+	items := nonWhitespace(valuesOf(s))
+	switch {
+	case one(keywords("none"))(items):
+		return nil
+	case one(keywords("auto"))(items):
+		return [][2]string{{"“", "”"}, {"‘", "’"}}
+	}
+	ret := [][2]string{}
+	for i := 0; i+1 < len(items); i += 2 {
+		ret = append(ret, [2]string{items[i].Token.Value, items[i+1].Token.Value})
+	}
+	return ret
+}
@@ -0,0 +1,206 @@
+package css
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pishiko/tenmusu/internal/parser/model"
+)
+
+// generatedText returns the text of a generated box, or "<nil>" without one.
+func generatedText(box *model.Node) string {
+	if box == nil {
+		return "<nil>"
+	}
+	if len(box.Children) != 1 {
+		return ""
+	}
+	return box.Children[0].Value
+}
+
+// generatedTest is the text of the ::before and ::after boxes of the element with the id.
+type generatedTest struct {
+	id, before, after string
+}
+
+func checkGenerated(t *testing.T, name string, doc *model.Node, tests []generatedTest) {
+	t.Helper()
+	for _, test := range tests {
+		node := doc.GetElementByID(test.id)
+		if node == nil {
+			t.Fatalf("%s: no element #%s", name, test.id)
+		}
+		if got := generatedText(node.Before); got != test.before {
+			t.Errorf("%s: ::before of #%s = %q, want %q", name, test.id, got, test.before)
+		}
+		if got := generatedText(node.After); got != test.after {
+			t.Errorf("%s: ::after of #%s = %q, want %q", name, test.id, got, test.after)
+		}
+	}
+}
+
+func TestGeneratedContent(t *testing.T) {
+	tests := []struct {
+		sheet         string
+		before, after string
+	}{
+		{`p::before { content: "a" } p::after { content: "b" }`, "a", "b"},
+		{`p::before { content: "[" attr(title) "]" attr(missing) }`, "[T]", "<nil>"},
+		{`p::before { content: "" }`, "", "<nil>"},
+		{`p::before { content: none } p::after { content: normal }`, "<nil>", "<nil>"},
+		{`p::before { content: "a"; display: none }`, "<nil>", "<nil>"},
+		{`p::before { content: "a" } p::before { content: none }`, "<nil>", "<nil>"},
+		{`.x::after { content: "a" } p::after { content: "b" }`, "<nil>", "b"},
+		{`p:hover::before { content: "a" }`, "<nil>", "<nil>"},
+		// without a pseudo-element, the rule applies to the element alone
+		{`p { content: "a" }`, "<nil>", "<nil>"},
+	}
+	for _, test := range tests {
+		doc := styleDocument(`<p id="p" title="T">text</p>`, sheet(AuthorOrigin, test.sheet))
+		checkGenerated(t, test.sheet, doc, []generatedTest{{"p", test.before, test.after}})
+	}
+}
+
+func TestGeneratedStyle(t *testing.T) {
+	doc := styleDocument(`<p id="p" style="color: green">text</p>`,
+		sheet(AuthorOrigin, `p::before { content: "a"; font-style: italic } p::after { content: "b" }`))
+	p := doc.GetElementByID("p")
+	if p.Before.Style["font-style"] != "italic" || p.Before.Style["color"] != "green" {
+		t.Errorf("::before has font-style %q and color %q, want italic and the color of #p", p.Before.Style["font-style"], p.Before.Style["color"])
+	}
+	if p.After.Style["font-style"] != "normal" {
+		t.Errorf("::after has font-style %q, want normal", p.After.Style["font-style"])
+	}
+	if p.Before.Parent != p || p.Before.Children[0].Parent != p.Before {
+		t.Errorf("generated boxes are not attached to #p")
+	}
+}
+
+func TestQuotes(t *testing.T) {
+	const markup = `<q id="a">1<q id="b">2<q id="c">3</q></q></q><q id="d">4</q>`
+	tests := []struct {
+		name  string
+		sheet string
+		want  []generatedTest
+	}{
+		{"auto", `q::before { content: open-quote } q::after { content: close-quote }`, []generatedTest{
+			{"a", "“", "”"},
+			{"b", "‘", "’"},
+			// deeper levels repeat the last pair
+			{"c", "‘", "’"},
+			{"d", "“", "”"},
+		}},
+		{"quotes", `q { quotes: "<" ">" "[" "]" } q::before { content: open-quote } q::after { content: close-quote }`, []generatedTest{
+			{"a", "<", ">"},
+			{"b", "[", "]"},
+			{"c", "[", "]"},
+			{"d", "<", ">"},
+		}},
+		{"none", `q { quotes: none } q::before { content: open-quote "x" } q::after { content: close-quote }`, []generatedTest{
+			{"a", "x", ""},
+			{"d", "x", ""},
+		}},
+		{"no-open-quote", `q::before { content: open-quote } q::after { content: close-quote } #b::before { content: no-open-quote }`, []generatedTest{
+			{"a", "“", "”"},
+			{"b", "", "’"},
+			{"c", "‘", "’"},
+		}},
+		// close-quote without an open quote is ignored, and keeps the depth
+		{"unbalanced", `q::after { content: close-quote } #d::before { content: open-quote }`, []generatedTest{
+			{"a", "<nil>", ""},
+			{"d", "“", "”"},
+		}},
+	}
+	for _, test := range tests {
+		doc := styleDocument(markup, sheet(AuthorOrigin, test.sheet))
+		checkGenerated(t, test.name, doc, test.want)
+	}
+}
+
+// userAgentSheet parses the style sheet of the browser.
+func userAgentSheet(t *testing.T) []CSSRule {
+	t.Helper()
+	data, err := os.ReadFile("../../../browser.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sheet(UserAgentOrigin, string(data))
+}
+
+// markers returns the marker texts of the list items in tree order, joined by "|".
+func markers(doc *model.Node) string {
+	texts := []string{}
+	for _, li := range doc.GetElementsByTagName("li") {
+		texts = append(texts, generatedText(li.Marker))
+	}
+	return strings.Join(texts, "|")
+}
+
+func TestListNumbering(t *testing.T) {
+	ua := userAgentSheet(t)
+	tests := []struct {
+		markup string
+		want   string
+	}{
+		{`<ol><li>a</li><li>b</li><li>c</li></ol>`, "1. |2. |3. "},
+		{`<ol start="5"><li>a</li><li>b</li><li>c</li></ol>`, "5. |6. |7. "},
+		{`<ol start="-1"><li>a</li><li>b</li><li>c</li></ol>`, "-1. |0. |1. "},
+		{`<ol start=" 3rd"><li>a</li><li>b</li></ol>`, "3. |4. "},
+		{`<ol start="x"><li>a</li><li>b</li></ol>`, "1. |2. "},
+		{`<ol reversed><li>a</li><li>b</li><li>c</li></ol>`, "3. |2. |1. "},
+		{`<ol reversed start="10"><li>a</li><li>b</li><li>c</li></ol>`, "10. |9. |8. "},
+		{`<ol><li>a</li><li value="7">b</li><li>c</li></ol>`, "1. |7. |8. "},
+		{`<ol reversed><li>a</li><li value="7">b</li><li>c</li></ol>`, "3. |7. |6. "},
+		{`<ol start="4" style="list-style-type: upper-roman"><li>a</li><li>b</li></ol>`, "IV. |V. "},
+		{`<ol style="list-style-type: lower-alpha" start="26"><li>a</li><li>b</li></ol>`, "z. |aa. "},
+		{`<ol style="list-style: none"><li>a</li><li>b</li></ol>`, "<nil>|<nil>"},
+		{`<ol><li style="list-style-type: '- '">a</li></ol>`, "- "},
+		// nested lists count on their own
+		{`<ol><li>a<ol start="3"><li>b</li><li>c</li></ol></li><li>d</li></ol>`, "1. |3. |4. |2. "},
+		{`<ul><li>a<ul><li>b<ul><li>c</li></ul></li></ul></li></ul>`, "• |◦ |▪ "},
+	}
+	for _, test := range tests {
+		doc := styleDocument(test.markup, ua)
+		if got := markers(doc); got != test.want {
+			t.Errorf("%s: markers %q, want %q", test.markup, got, test.want)
+		}
+	}
+}
+
+func TestCounters(t *testing.T) {
+	tests := []struct {
+		name, markup, sheet string
+		want                []generatedTest
+	}{
+		{"upper-roman",
+			`<h2 id="a">a</h2><h2 id="b">b</h2><h2 id="c">c</h2><h2 id="d">d</h2>`,
+			`h2 { counter-increment: sec } h2::before { content: counter(sec, upper-roman) ". " }`,
+			[]generatedTest{{"a", "I. ", "<nil>"}, {"b", "II. ", "<nil>"}, {"c", "III. ", "<nil>"}, {"d", "IV. ", "<nil>"}}},
+		{"reset and set",
+			`<div id="r" style="counter-reset: sec 3"></div><h2 id="a">a</h2><h2 id="b" style="counter-set: sec 9">b</h2>`,
+			`h2 { counter-increment: sec 2 } h2::before { content: counter(sec, lower-roman) }`,
+			[]generatedTest{{"a", "v", "<nil>"}, {"b", "ix", "<nil>"}}},
+		{"not in scope",
+			`<p id="a">a</p>`,
+			`p::before { content: counter(missing) counter(missing, upper-alpha) }`,
+			[]generatedTest{{"a", "00", "<nil>"}}},
+		{"counters",
+			`<ol><li id="a">a<ol><li id="b">b</li><li id="c">c</li></ol></li><li id="d">d</li></ol>`,
+			`ol { counter-reset: item } li { counter-increment: item } li::before { content: counters(item, ".") " " }`,
+			[]generatedTest{{"a", "1 ", "<nil>"}, {"b", "1.1 ", "<nil>"}, {"c", "1.2 ", "<nil>"}, {"d", "2 ", "<nil>"}}},
+		{"in ::before and ::after",
+			`<div style="counter-reset: n"><p id="a">a</p><p id="b">b</p></div>`,
+			`p::before { counter-increment: n; content: counter(n) } p::after { counter-increment: n 10; content: counter(n) }`,
+			[]generatedTest{{"a", "1", "11"}, {"b", "12", "22"}}},
+		// without a reset, each ::before creates a counter seen in its element only
+		{"scope",
+			`<p id="a">a</p><p id="b">b</p>`,
+			`p::before { counter-increment: n; content: counter(n) } p::after { content: counter(n) }`,
+			[]generatedTest{{"a", "1", "1"}, {"b", "1", "1"}}},
+	}
+	for _, test := range tests {
+		doc := styleDocument(test.markup, sheet(AuthorOrigin, test.sheet))
+		checkGenerated(t, test.name, doc, test.want)
+	}
+}
@@ -0,0 +1,371 @@
+package css
+
+import (
+	"errors"
+	"strings"
+)
+
+// Media is the environment media queries are evaluated against.
+type Media struct {
+	Type          string // "screen" or "print"
+	Width, Height float64
+	ColorScheme   string // "light" or "dark"
+	ReducedMotion bool
+}
+
+// MediaQueryList is a comma separated list of media queries. It matches
+// when any of its queries matches, and an empty list matches everything.
+// https://www.w3.org/TR/mediaqueries-4/
+type MediaQueryList []MediaQuery
+
+type MediaQuery struct {
+	not       bool
+	mediaType string         // empty for all
+	condition mediaCondition // nil when the query has no condition
+	invalid   bool           // the query failed to parse and never matches
+}
+
+func (l MediaQueryList) Matches(m Media) bool {
+	if len(l) == 0 {
+		return true
+	}
+	for _, q := range l {
+		if q.Matches(m) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q MediaQuery) Matches(m Media) bool {
+	if q.invalid {
+		return false
+	}
+	ret := q.mediaType == "" || q.mediaType == "all" || q.mediaType == m.Type
+	if ret && q.condition != nil {
+		ret = q.condition.eval(m)
+	}
+	return ret != q.not
+}
+
+type mediaCondition interface {
+	eval(m Media) bool
+}
+
+type mediaAnd []mediaCondition
+
+func (c mediaAnd) eval(m Media) bool {
+	for _, cond := range c {
+		if !cond.eval(m) {
+			return false
+		}
+	}
+	return true
+}
+
+type mediaOr []mediaCondition
+
+func (c mediaOr) eval(m Media) bool {
+	for _, cond := range c {
+		if cond.eval(m) {
+			return true
+		}
+	}
+	return false
+}
+
+type mediaNot struct {
+	condition mediaCondition
+}
+
+func (c mediaNot) eval(m Media) bool {
+	return !c.condition.eval(m)
+}
+
+// mediaFeature is a test like (min-width: 600px) or (width >= 600px).
+// op is empty for a feature in a boolean context like (color).
+type mediaFeature struct {
+	name  string
+	op    string // one of "", "=", "<", "<=", ">", ">="
+	value ComponentValue
+}
+
+func (f mediaFeature) eval(m Media) bool {
+	switch f.name {
+	case "width", "height":
+		actual := m.Width
+		if f.name == "height" {
+			actual = m.Height
+		}
+		if f.op == "" {
+			return actual != 0
+		}
+		length, ok := mediaLength(f.value, m)
+		return ok && compare(actual, f.op, length)
+	case "orientation":
+		orientation := "landscape"
+		if m.Height >= m.Width {
+			orientation = "portrait"
+		}
+		return f.op == "" || f.value.IsIdent(orientation)
+	case "prefers-color-scheme":
+		scheme := m.ColorScheme
+		if scheme == "" {
+			scheme = "light"
+		}
+		return f.op == "" || f.value.IsIdent(scheme)
+	case "prefers-reduced-motion":
+		if f.op == "" {
+			return m.ReducedMotion
+		}
+		if m.ReducedMotion {
+			return f.value.IsIdent("reduce")
+		}
+		return f.value.IsIdent("no-preference")
+	case "hover", "any-hover":
+		// the window is used with a mouse, which can hover
+		return f.op == "" || f.value.IsIdent("hover")
+	case "pointer", "any-pointer":
+		return f.op == "" || f.value.IsIdent("fine")
+	}
+	// unknown features never match
+	return false
+}
+
+func compare(a float64, op string, b float64) bool {
+	switch op {
+	case "=":
+		return a == b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+// mediaLength resolves a length in a media query to pixels. Relative
+// units are based on the initial font size.
+func mediaLength(v ComponentValue, m Media) (float64, bool) {
+	ctx := initialLengthContext
+	ctx.ViewportWidth, ctx.ViewportHeight = m.Width, m.Height
+	switch {
+	case v.Is(NumberToken) && v.Token.Number == 0:
+		return 0, true
+	case v.Is(DimensionToken):
+		return ctx.Length(v.Token.Number, v.Token.Unit)
+	case IsMathFunction(v):
+		c, err := ParseCalc(v)
+		if err != nil || c.typ != lengthType {
+			return 0, false
+		}
+		return c.Resolve(ctx), true
+	}
+	return 0, false
+}
+
+// ParseMediaQueryList parses a media query list, as found in @media and
+// in the media attribute of <link>.
+func ParseMediaQueryList(s string) MediaQueryList {
+	parser := newCSSParser("", s)
+	return parseMediaQueryList(parser.componentValues())
+}
+
+func parseMediaQueryList(values []ComponentValue) MediaQueryList {
+	values = trimWhitespace(values)
+	if len(values) == 0 {
+		return nil
+	}
+	ret := MediaQueryList{}
+	for _, part := range splitByComma(values) {
+		q, err := parseMediaQuery(nonWhitespace(part))
+		if err != nil {
+			// an invalid query becomes "not all" without invalidating the others
+			q = MediaQuery{invalid: true}
+		}
+		ret = append(ret, q)
+	}
+	return ret
+}
+
+func nonWhitespace(values []ComponentValue) []ComponentValue {
+	ret := []ComponentValue{}
+	for _, v := range values {
+		if !v.Is(WhitespaceToken) {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+func parseMediaQuery(items []ComponentValue) (MediaQuery, error) {
+	q := MediaQuery{}
+	if len(items) == 0 {
+		return q, errors.New("empty media query")
+	}
+	if !items[0].Is(IdentToken) || items[0].IsIdent("not") && len(items) > 1 && items[1].Is(LeftParenToken) {
+		condition, err := parseMediaCondition(items, true)
+		q.condition = condition
+		return q, err
+	}
+
+	if items[0].IsIdent("not") || items[0].IsIdent("only") {
+		q.not = items[0].IsIdent("not")
+		items = items[1:]
+	}
+	if len(items) == 0 || !items[0].Is(IdentToken) {
+		return q, errors.New("expected media type")
+	}
+	q.mediaType = strings.ToLower(items[0].Token.Value)
+	switch q.mediaType {
+	case "and", "or", "not", "only", "layer":
+		return q, errors.New("invalid media type " + q.mediaType)
+	}
+	items = items[1:]
+	if len(items) == 0 {
+		return q, nil
+	}
+	if !items[0].IsIdent("and") {
+		return q, errors.New("expected and after media type")
+	}
+	condition, err := parseMediaCondition(items[1:], false)
+	q.condition = condition
+	return q, err
+}
+
+// parseMediaCondition parses "not <in-parens>", or <in-parens> joined by
+// "and", or by "or" when allowOr is set.
+func parseMediaCondition(items []ComponentValue, allowOr bool) (mediaCondition, error) {
+	if len(items) == 0 {
+		return nil, errors.New("expected media condition")
+	}
+	if items[0].IsIdent("not") {
+		if len(items) != 2 {
+			return nil, errors.New("unexpected tokens after not")
+		}
+		c, err := parseMediaInParens(items[1])
+		return mediaNot{condition: c}, err
+	}
+
+	first, err := parseMediaInParens(items[0])
+	if err != nil {
+		return nil, err
+	}
+	conditions := []mediaCondition{first}
+	joiner := ""
+	for i := 1; i < len(items); i += 2 {
+		if !items[i].IsIdent("and") && !(allowOr && items[i].IsIdent("or")) {
+			return nil, errors.New("expected and or or in media condition")
+		}
+		word := strings.ToLower(items[i].Token.Value)
+		if joiner != "" && joiner != word {
+			return nil, errors.New("cannot mix and and or without parentheses")
+		}
+		joiner = word
+		if i+1 >= len(items) {
+			return nil, errors.New("expected media condition after " + word)
+		}
+		c, err := parseMediaInParens(items[i+1])
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, c)
+	}
+	switch {
+	case len(conditions) == 1:
+		return first, nil
+	case joiner == "or":
+		return mediaOr(conditions), nil
+	}
+	return mediaAnd(conditions), nil
+}
+
+func parseMediaInParens(v ComponentValue) (mediaCondition, error) {
+	if !v.Is(LeftParenToken) {
+		return nil, errors.New("expected ( in media condition")
+	}
+	items := nonWhitespace(v.Children)
+	if len(items) > 0 && (items[0].Is(LeftParenToken) || items[0].IsIdent("not")) {
+		return parseMediaCondition(items, true)
+	}
+	return parseMediaFeature(items)
+}
+
+func parseMediaFeature(items []ComponentValue) (mediaCondition, error) {
+	// (name)
+	if len(items) == 1 && items[0].Is(IdentToken) {
+		return mediaFeature{name: strings.ToLower(items[0].Token.Value)}, nil
+	}
+	// (name: value)
+	if len(items) == 3 && items[0].Is(IdentToken) && items[1].Is(ColonToken) {
+		name := strings.ToLower(items[0].Token.Value)
+		op := "="
+		if after, ok := strings.CutPrefix(name, "min-"); ok {
+			name, op = after, ">="
+		} else if after, ok := strings.CutPrefix(name, "max-"); ok {
+			name, op = after, "<="
+		}
+		return mediaFeature{name: name, op: op, value: items[2]}, nil
+	}
+
+	// range syntax: (name op value), (value op name) or (value op name op value)
+	parts := []ComponentValue{}
+	ops := []string{}
+	for i := 0; i < len(items); i++ {
+		if op, n := rangeOperator(items[i:]); op != "" {
+			ops = append(ops, op)
+			i += n - 1
+			continue
+		}
+		parts = append(parts, items[i])
+	}
+	switch {
+	case len(parts) == 2 && len(ops) == 1 && parts[0].Is(IdentToken):
+		return mediaFeature{name: strings.ToLower(parts[0].Token.Value), op: ops[0], value: parts[1]}, nil
+	case len(parts) == 2 && len(ops) == 1 && parts[1].Is(IdentToken):
+		return mediaFeature{name: strings.ToLower(parts[1].Token.Value), op: flip(ops[0]), value: parts[0]}, nil
+	case len(parts) == 3 && len(ops) == 2 && parts[1].Is(IdentToken):
+		name := strings.ToLower(parts[1].Token.Value)
+		return mediaAnd{
+			mediaFeature{name: name, op: flip(ops[0]), value: parts[0]},
+			mediaFeature{name: name, op: ops[1], value: parts[2]},
+		}, nil
+	}
+	return nil, errors.New("invalid media feature")
+}
+
+// rangeOperator reads a comparison operator, which is made of one or two delim tokens.
+func rangeOperator(items []ComponentValue) (string, int) {
+	if len(items) == 0 || !items[0].Is(DelimToken) {
+		return "", 0
+	}
+	switch op := items[0].Token.Value; op {
+	case "=":
+		return op, 1
+	case "<", ">":
+		if len(items) > 1 && items[1].IsDelim("=") {
+			return op + "=", 2
+		}
+		return op, 1
+	}
+	return "", 0
+}
+
+// flip turns "value op name" into "name op value".
+func flip(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case "<=":
+		return ">="
+	case ">":
+		return "<"
+	case ">=":
+		return "<="
+	}
+	return op
+}
@@ -0,0 +1,48 @@
+package css
+
+import "testing"
+
+func TestMediaQueryList(t *testing.T) {
+	screen := Media{Type: "screen", Width: 800, Height: 600}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"all", true},
+		{"print", false},
+		{"screen, print", true},
+		{"not print", true},
+		{"(min-width: 600px)", true},
+		{"(width > 800px)", false},
+		{"screen and (orientation: landscape)", true},
+		{"(hover: hover)", true},
+		{"(hover: none)", false},
+		{"(any-hover)", true},
+		{"(pointer: fine)", true},
+		{"(pointer: coarse)", false},
+		{"(any-pointer: fine) and (hover)", true},
+		{"(unknown-feature)", false},
+	}
+	for _, test := range tests {
+		if got := ParseMediaQueryList(test.query).Matches(screen); got != test.want {
+			t.Errorf("%q matches = %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestWithMedia(t *testing.T) {
+	rules := WithMedia(CSSParse("p { color: red } @media (min-width: 600px) { a { color: blue } }"), ParseMediaQueryList("print"))
+	if len(rules) != 2 {
+		t.Fatalf("got %d rules, want 2", len(rules))
+	}
+	if got := MatchMedia(rules, Media{Type: "screen", Width: 800}); len(got) != 0 {
+		t.Errorf("%d rules of a print sheet apply on screen", len(got))
+	}
+	if got := MatchMedia(rules, Media{Type: "print", Width: 800}); len(got) != 2 {
+		t.Errorf("%d rules apply in print, want 2", len(got))
+	}
+	if got := MatchMedia(rules, Media{Type: "print", Width: 400}); len(got) != 1 {
+		t.Errorf("%d rules apply in narrow print, want 1", len(got))
+	}
+}
@@ -0,0 +1,215 @@
+package css
+
+import "strings"
+
+// property describes a longhand property.
+// https://www.w3.org/TR/css-cascade-4/#cascaded
+type property struct {
+	initial   string
+	inherited bool
+	// valid reports whether the value, without whitespace, matches the grammar of the property.
+	valid func(items []ComponentValue) bool
+}
+
+// properties are the supported longhand properties. Declarations of
+// other properties are dropped.
+var properties = map[string]property{}
+
+func init() {
+	inherited := func(name, initial string, valid func([]ComponentValue) bool) {
+		properties[name] = property{initial: initial, inherited: true, valid: valid}
+	}
+	reset := func(name, initial string, valid func([]ComponentValue) bool) {
+		properties[name] = property{initial: initial, valid: valid}
+	}
+
+	// fonts and text
+	inherited("color", "black", one(isColor))
+	inherited("font-family", "sans-serif", isFontFamily)
+	inherited("font-size", "medium", one(isFontSize))
+	inherited("font-style", "normal", one(keywords("normal", "italic", "oblique")))
+	inherited("font-weight", "normal", one(func(v ComponentValue) bool { return isFontWeight(v) || v.IsIdent("normal") }))
+	inherited("font-variant", "normal", one(keywords("normal", "small-caps")))
+	inherited("font-stretch", "normal", one(func(v ComponentValue) bool { return isFontStretch(v) || v.IsIdent("normal") || v.Is(PercentageToken) }))
+	inherited("line-height", "normal", one(func(v ComponentValue) bool { return isLengthPercentage(v) || v.Is(NumberToken) || v.IsIdent("normal") }))
+	inherited("white-space", "normal", one(keywords("normal", "pre", "nowrap", "pre-wrap", "pre-line", "break-spaces")))
+	inherited("text-align", "start", one(keywords("start", "end", "left", "right", "center", "justify")))
+	inherited("text-indent", "0", one(isLengthPercentage))
+	inherited("text-transform", "none", one(keywords("none", "capitalize", "uppercase", "lowercase", "full-width")))
+	inherited("letter-spacing", "normal", one(func(v ComponentValue) bool { return isLength(v) || v.IsIdent("normal") }))
+	inherited("word-spacing", "normal", one(func(v ComponentValue) bool { return isLength(v) || v.IsIdent("normal") }))
+	inherited("visibility", "visible", one(keywords("visible", "hidden", "collapse")))
+	inherited("direction", "ltr", one(keywords("ltr", "rtl")))
+	inherited("cursor", "auto", one(func(v ComponentValue) bool { return v.Is(IdentToken) }))
+	inherited("list-style-type", "disc", one(isListStyleType))
+	inherited("list-style-position", "outside", one(keywords("inside", "outside")))
+	inherited("list-style-image", "none", one(isImage))
+	reset("text-decoration-line", "none", some(1, 4, keywords("none", "underline", "overline", "line-through", "blink")))
+	reset("text-decoration-color", "currentcolor", one(isColor))
+	reset("vertical-align", "baseline", one(func(v ComponentValue) bool {
+		return isLengthPercentage(v) || keywords("baseline", "sub", "super", "text-top", "text-bottom", "middle", "top", "bottom")(v)
+	}))
+
+	// generated content
+	reset("content", "normal", isContent)
+	inherited("quotes", "auto", func(items []ComponentValue) bool {
+		return one(keywords("auto", "none"))(items) ||
+			len(items)%2 == 0 && some(2, len(items), func(v ComponentValue) bool { return v.Is(StringToken) })(items)
+	})
+	for _, name := range []string{"counter-reset", "counter-increment", "counter-set"} {
+		reset(name, "none", isCounterList)
+	}
+
+	// boxes
+	reset("display", "inline", some(1, 2, keywords("none", "contents", "block", "inline", "inline-block", "flow", "flow-root",
+		"list-item", "flex", "inline-flex", "grid", "inline-grid", "table", "table-row", "table-cell", "run-in")))
+	reset("position", "static", one(keywords("static", "relative", "absolute", "fixed", "sticky")))
+	reset("float", "none", one(keywords("none", "left", "right", "inline-start", "inline-end")))
+	reset("clear", "none", one(keywords("none", "left", "right", "both", "inline-start", "inline-end")))
+	reset("overflow", "visible", some(1, 2, keywords("visible", "hidden", "clip", "scroll", "auto")))
+	reset("opacity", "1", one(func(v ComponentValue) bool { return v.Is(NumberToken) || v.Is(PercentageToken) }))
+	reset("z-index", "auto", one(func(v ComponentValue) bool { return v.Is(NumberToken) && v.Token.Integer || v.IsIdent("auto") }))
+	for _, name := range []string{"width", "height", "min-width", "min-height"} {
+		reset(name, "auto", one(isBoxLength))
+	}
+	for _, name := range []string{"max-width", "max-height"} {
+		reset(name, "none", one(func(v ComponentValue) bool { return isLengthPercentage(v) || v.IsIdent("none") }))
+	}
+	for _, side := range []string{"top", "right", "bottom", "left"} {
+		reset(side, "auto", one(isBoxLength))
+		reset("margin-"+side, "0", one(isBoxLength))
+		reset("padding-"+side, "0", one(isLengthPercentage))
+		reset("border-"+side+"-width", "medium", one(isLineWidth))
+		reset("border-"+side+"-style", "none", one(isLineStyle))
+		reset("border-"+side+"-color", "currentcolor", one(isColor))
+	}
+	for _, corner := range []string{"top-left", "top-right", "bottom-right", "bottom-left"} {
+		reset("border-"+corner+"-radius", "0", some(1, 2, isLengthPercentage))
+	}
+	reset("outline-width", "medium", one(isLineWidth))
+	reset("outline-style", "none", one(func(v ComponentValue) bool { return isLineStyle(v) || v.IsIdent("auto") }))
+	reset("outline-color", "currentcolor", one(isColor))
+
+	// backgrounds
+	reset("background-color", "transparent", one(isColor))
+	reset("background-image", "none", one(isImage))
+	reset("background-position", "0% 0%", some(1, 4, isPosition))
+	reset("background-size", "auto", func(items []ComponentValue) bool {
+		return one(keywords("cover", "contain"))(items) ||
+			some(1, 2, func(v ComponentValue) bool { return isLengthPercentage(v) || v.IsIdent("auto") })(items)
+	})
+	reset("background-repeat", "repeat", some(1, 2, isRepeat))
+	reset("background-attachment", "scroll", one(keywords("scroll", "fixed", "local")))
+	reset("background-origin", "padding-box", one(isBox))
+	reset("background-clip", "border-box", one(isBox))
+
+	// flex items
+	reset("flex-grow", "0", one(func(v ComponentValue) bool { return v.Is(NumberToken) }))
+	reset("flex-shrink", "1", one(func(v ComponentValue) bool { return v.Is(NumberToken) }))
+	reset("flex-basis", "auto", one(func(v ComponentValue) bool {
+		return isLengthPercentage(v) || v.IsIdent("auto") || v.IsIdent("content")
+	}))
+}
+
+// isCSSWideKeyword reports whether items is one of the keywords every property takes.
+// https://www.w3.org/TR/css-values-4/#common-keywords
+func isCSSWideKeyword(items []ComponentValue) bool {
+	return len(items) == 1 && (items[0].IsIdent("inherit") || items[0].IsIdent("initial") ||
+		items[0].IsIdent("unset") || items[0].IsIdent("revert"))
+}
+
+// validDeclaration reports whether decl is of a supported property and
+// matches its grammar. Custom properties take anything.
+func validDeclaration(decl Declaration) bool {
+	if isCustomProperty(decl.Name) {
+		return true
+	}
+	p, ok := properties[decl.Name]
+	if !ok {
+		return false
+	}
+	items := nonWhitespace(decl.Value)
+	return isCSSWideKeyword(items) || p.valid(items)
+}
+
+// one matches a single value.
+func one(valid func(ComponentValue) bool) func([]ComponentValue) bool {
+	return some(1, 1, valid)
+}
+
+// some matches from least to most values, each of them valid.
+func some(least, most int, valid func(ComponentValue) bool) func([]ComponentValue) bool {
+	return func(items []ComponentValue) bool {
+		if len(items) < least || len(items) > most {
+			return false
+		}
+		for _, item := range items {
+			if !valid(item) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// keywords matches any of names.
+func keywords(names ...string) func(ComponentValue) bool {
+	return func(v ComponentValue) bool {
+		if !v.Is(IdentToken) {
+			return false
+		}
+		for _, name := range names {
+			if strings.EqualFold(v.Token.Value, name) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func isLength(v ComponentValue) bool {
+	return isLengthPercentage(v) && !v.Is(PercentageToken)
+}
+
+func isFontFamily(items []ComponentValue) bool {
+	_, err := fontFamily(items)
+	return err == nil
+}
+
+func isListStyleType(v ComponentValue) bool {
+	return v.Is(IdentToken) || v.Is(StringToken) || v.IsFunction() && strings.EqualFold(v.Token.Value, "symbols")
+}
+
+// isContent matches normal, none, or a list of strings, attr(), counter(),
+// counters() and quotes.
+// https://www.w3.org/TR/css-content-3/#content-property
+func isContent(items []ComponentValue) bool {
+	if one(keywords("normal", "none"))(items) {
+		return true
+	}
+	return some(1, len(items), func(v ComponentValue) bool {
+		if v.IsFunction() {
+			switch strings.ToLower(v.Token.Value) {
+			case "attr", "counter", "counters", "url":
+				return true
+			}
+		}
+		return v.Is(StringToken) || v.Is(URLToken) || keywords("open-quote", "close-quote", "no-open-quote", "no-close-quote")(v)
+	})(items)
+}
+
+// isCounterList matches none, or counter names each followed by an optional integer.
+func isCounterList(items []ComponentValue) bool {
+	if one(keywords("none"))(items) {
+		return true
+	}
+	for i, item := range items {
+		switch {
+		case item.Is(IdentToken) && !keywords("none", "inherit", "initial", "unset", "revert")(item):
+		case item.Is(NumberToken) && item.Token.Integer && i > 0 && items[i-1].Is(IdentToken):
+		default:
+			return false
+		}
+	}
+	return len(items) > 0
+}
@@ -0,0 +1,296 @@
+package css
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/pishiko/tenmusu/internal/parser/model"
+)
+
+// PseudoClassSelector matches the structural and dynamic pseudo-classes without arguments.
+type PseudoClassSelector struct {
+	name string
+}
+
+var pseudoClasses = map[string]func(node *model.Node) bool{
+	"first-child": func(node *model.Node) bool {
+		return node.PreviousElementSibling() == nil
+	},
+	"last-child": func(node *model.Node) bool {
+		return node.NextElementSibling() == nil
+	},
+	"only-child": func(node *model.Node) bool {
+		return node.PreviousElementSibling() == nil && node.NextElementSibling() == nil
+	},
+	"first-of-type": func(node *model.Node) bool {
+		return nthIndex(node, false, sameType(node)) == 1
+	},
+	"last-of-type": func(node *model.Node) bool {
+		return nthIndex(node, true, sameType(node)) == 1
+	},
+	"only-of-type": func(node *model.Node) bool {
+		return nthIndex(node, false, sameType(node)) == 1 && nthIndex(node, true, sameType(node)) == 1
+	},
+	"root": func(node *model.Node) bool {
+		return node.Parent == nil || node.Parent.Type == model.Document
+	},
+	"empty": func(node *model.Node) bool {
+		for _, child := range node.Children {
+			if child.Type == model.Element || (child.Type == model.Text && child.Value != "") {
+				return false
+			}
+		}
+		return true
+	},
+	"link": func(node *model.Node) bool {
+		return isLink(node) && node.State&model.StateVisited == 0
+	},
+	"visited": func(node *model.Node) bool {
+		return isLink(node) && node.State&model.StateVisited != 0
+	},
+	"any-link": isLink,
+	"hover": func(node *model.Node) bool {
+		return node.State&model.StateHover != 0
+	},
+	"active": func(node *model.Node) bool {
+		return node.State&model.StateActive != 0
+	},
+	"focus": func(node *model.Node) bool {
+		return node.State&model.StateFocus != 0
+	},
+}
+
+func (ps *PseudoClassSelector) Matches(node *model.Node) bool {
+	return node.Type == model.Element && pseudoClasses[ps.name](node)
+}
+
+func (ps *PseudoClassSelector) Specificity() Specificity {
+	return Specificity{0, 1, 0}
+}
+
+func isLink(node *model.Node) bool {
+	switch node.Value {
+	case "a", "area", "link":
+		_, ok := node.Attrs["href"]
+		return ok
+	}
+	return false
+}
+
+func sameType(node *model.Node) Selector {
+	return newTagSelector(node.Value)
+}
+
+// nthIndex returns the 1-based position of node among its element siblings
+// matched by of, counted from the end when last is set.
+func nthIndex(node *model.Node, last bool, of Selector) int {
+	if of == nil {
+		index, count := node.ElementIndex()
+		if last {
+			return count - index
+		}
+		return index + 1
+	}
+	index := 1
+	next := (*model.Node).PreviousElementSibling
+	if last {
+		next = (*model.Node).NextElementSibling
+	}
+	for sibling := next(node); sibling != nil; sibling = next(sibling) {
+		if of == nil || of.Matches(sibling) {
+			index++
+		}
+	}
+	return index
+}
+
+// NthSelector matches :nth-child(), :nth-last-child(), :nth-of-type() and :nth-last-of-type().
+type NthSelector struct {
+	a, b   int
+	last   bool
+	ofType bool
+	of     []Selector // the "of S" part of :nth-child()
+}
+
+func (ns *NthSelector) Matches(node *model.Node) bool {
+	if node.Type != model.Element {
+		return false
+	}
+	var of Selector
+	if ns.ofType {
+		of = sameType(node)
+	} else if ns.of != nil {
+		of = &IsSelector{selectors: ns.of}
+		if !of.Matches(node) {
+			return false
+		}
+	}
+	index := nthIndex(node, ns.last, of)
+	// index = a*n + b for some n >= 0
+	if ns.a == 0 {
+		return index == ns.b
+	}
+	n := index - ns.b
+	return n%ns.a == 0 && n/ns.a >= 0
+}
+
+func (ns *NthSelector) Specificity() Specificity {
+	if ns.of != nil {
+		return Specificity{0, 1, 0}.Add(maxSpecificity(ns.of))
+	}
+	return Specificity{0, 1, 0}
+}
+
+// NotSelector matches elements that match none of its selectors.
+type NotSelector struct {
+	selectors []Selector
+}
+
+func (ns *NotSelector) Matches(node *model.Node) bool {
+	if node.Type != model.Element {
+		return false
+	}
+	for _, s := range ns.selectors {
+		if s.Matches(node) {
+			return false
+		}
+	}
+	return true
+}
+
+func (ns *NotSelector) Specificity() Specificity {
+	return maxSpecificity(ns.selectors)
+}
+
+// IsSelector matches :is() and :where(), which only differ in specificity.
+type IsSelector struct {
+	selectors []Selector
+	where     bool
+}
+
+func (is *IsSelector) Matches(node *model.Node) bool {
+	for _, s := range is.selectors {
+		if s.Matches(node) {
+			return true
+		}
+	}
+	return false
+}
+
+func (is *IsSelector) Specificity() Specificity {
+	if is.where {
+		return Specificity{}
+	}
+	return maxSpecificity(is.selectors)
+}
+
+func maxSpecificity(selectors []Selector) Specificity {
+	ret := Specificity{}
+	for _, s := range selectors {
+		if s.Specificity().Compare(ret) > 0 {
+			ret = s.Specificity()
+		}
+	}
+	return ret
+}
+
+// pseudoClass parses a pseudo-class after its colon.
+func (p *selectorParser) pseudoClass() (Selector, error) {
+	v := p.next()
+	switch {
+	case v.Is(IdentToken):
+		name := strings.ToLower(v.Token.Value)
+		if _, ok := pseudoClasses[name]; !ok {
+			return nil, errors.New("unknown pseudo-class :" + name)
+		}
+		return &PseudoClassSelector{name: name}, nil
+	case v.IsFunction():
+		name := strings.ToLower(v.Token.Value)
+		switch name {
+		case "nth-child", "nth-last-child", "nth-of-type", "nth-last-of-type":
+			return parseNth(name, v.Children)
+		case "not", "is", "where":
+			selectors, err := parseSelectorList(v.Children)
+			if err != nil {
+				return nil, err
+			}
+			if name == "not" {
+				return &NotSelector{selectors: selectors}, nil
+			}
+			return &IsSelector{selectors: selectors, where: name == "where"}, nil
+		}
+		return nil, errors.New("unknown pseudo-class :" + name + "()")
+	}
+	return nil, errors.New("unexpected " + v.String() + " after :")
+}
+
+func parseNth(name string, values []ComponentValue) (Selector, error) {
+	ret := &NthSelector{
+		last:   strings.Contains(name, "last"),
+		ofType: strings.HasSuffix(name, "of-type"),
+	}
+	anb := values
+	for i, v := range values {
+		if v.IsIdent("of") && !ret.ofType {
+			anb = values[:i]
+			of, err := parseSelectorList(values[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			ret.of = of
+			break
+		}
+	}
+	a, b, err := parseAnB(strings.ReplaceAll(Serialize(anb), " ", ""))
+	if err != nil {
+		return nil, err
+	}
+	ret.a, ret.b = a, b
+	return ret, nil
+}
+
+// parseAnB parses the An+B microsyntax with whitespace removed, like "2n+1", "-n+3" or "odd".
+// https://www.w3.org/TR/css-syntax-3/#anb-microsyntax
+func parseAnB(s string) (int, int, error) {
+	s = strings.ToLower(s)
+	switch s {
+	case "odd":
+		return 2, 1, nil
+	case "even":
+		return 2, 0, nil
+	}
+	invalid := errors.New("invalid An+B: " + s)
+	aPart, bPart, hasN := strings.Cut(s, "n")
+	if !hasN {
+		b, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, 0, invalid
+		}
+		return 0, b, nil
+	}
+
+	a := 0
+	switch aPart {
+	case "", "+":
+		a = 1
+	case "-":
+		a = -1
+	default:
+		var err error
+		if a, err = strconv.Atoi(aPart); err != nil {
+			return 0, 0, invalid
+		}
+	}
+	b := 0
+	if bPart != "" {
+		if bPart[0] != '+' && bPart[0] != '-' {
+			return 0, 0, invalid
+		}
+		var err error
+		if b, err = strconv.Atoi(bPart); err != nil {
+			return 0, 0, invalid
+		}
+	}
+	return a, b, nil
+}
@@ -1,22 +1,62 @@
 package css
 
-import "github.com/pishiko/tenmusu/internal/parser/model"
+import (
+	"errors"
+	"strings"
+
+	"github.com/pishiko/tenmusu/internal/parser/model"
+)
+
+// Specificity is the (a, b, c) specificity of a selector: the number of ID
+// selectors, of class, attribute and pseudo-class selectors, and of type selectors.
+// https://www.w3.org/TR/selectors-4/#specificity-rules
+type Specificity [3]int
+
+func (s Specificity) Add(other Specificity) Specificity {
+	return Specificity{s[0] + other[0], s[1] + other[1], s[2] + other[2]}
+}
+
+// Compare returns -1, 0 or +1 when s is lower than, equal to or higher than other.
+func (s Specificity) Compare(other Specificity) int {
+	for i := range s {
+		if s[i] != other[i] {
+			if s[i] < other[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
 
 type Selector interface {
 	Matches(node *model.Node) bool
-	Priority() int
+	Specificity() Specificity
 }
 
+// TagSelector matches elements by name, which is case-insensitive for
+// elements parsed as HTML, and case-sensitive for XML like SVG.
 type TagSelector struct {
-	tag string
+	tag   string // as written
+	lower string
+}
+
+func newTagSelector(tag string) *TagSelector {
+	return &TagSelector{tag: tag, lower: strings.ToLower(tag)}
 }
 
 func (ts *TagSelector) Matches(node *model.Node) bool {
-	return node.Type == model.Element && node.Value == ts.tag
+	if node.Type != model.Element {
+		return false
+	}
+	if node.Namespace == "" {
+		return node.Value == ts.lower
+	}
+	return node.Value == ts.tag
 }
 
-func (ts *TagSelector) Priority() int {
-	return 1
+func (ts *TagSelector) Specificity() Specificity {
+	return Specificity{0, 0, 1}
 }
 
 type DescendantSelector struct {
@@ -25,7 +65,7 @@ type DescendantSelector struct {
 }
 
 func (ds *DescendantSelector) Matches(node *model.Node) bool {
-	if !ds.ancestor.Matches(node) {
+	if !ds.descendant.Matches(node) {
 		return false
 	}
 	for node.Parent != nil {
@@ -37,6 +77,428 @@ func (ds *DescendantSelector) Matches(node *model.Node) bool {
 	return false
 }
 
-func (ds *DescendantSelector) Priority() int {
-	return ds.ancestor.Priority() + ds.descendant.Priority()
+func (ds *DescendantSelector) Specificity() Specificity {
+	return ds.ancestor.Specificity().Add(ds.descendant.Specificity())
+}
+
+// ChildSelector matches "parent > child".
+type ChildSelector struct {
+	parent Selector
+	child  Selector
+}
+
+func (cs *ChildSelector) Matches(node *model.Node) bool {
+	return cs.child.Matches(node) && node.Parent != nil && cs.parent.Matches(node.Parent)
+}
+
+func (cs *ChildSelector) Specificity() Specificity {
+	return cs.parent.Specificity().Add(cs.child.Specificity())
+}
+
+// AdjacentSiblingSelector matches "previous + next".
+type AdjacentSiblingSelector struct {
+	previous Selector
+	next     Selector
+}
+
+func (as *AdjacentSiblingSelector) Matches(node *model.Node) bool {
+	if !as.next.Matches(node) {
+		return false
+	}
+	sibling := node.PreviousElementSibling()
+	return sibling != nil && as.previous.Matches(sibling)
+}
+
+func (as *AdjacentSiblingSelector) Specificity() Specificity {
+	return as.previous.Specificity().Add(as.next.Specificity())
+}
+
+// GeneralSiblingSelector matches "previous ~ next".
+type GeneralSiblingSelector struct {
+	previous Selector
+	next     Selector
+}
+
+func (gs *GeneralSiblingSelector) Matches(node *model.Node) bool {
+	if !gs.next.Matches(node) {
+		return false
+	}
+	for sibling := node.PreviousElementSibling(); sibling != nil; sibling = sibling.PreviousElementSibling() {
+		if gs.previous.Matches(sibling) {
+			return true
+		}
+	}
+	return false
+}
+
+func (gs *GeneralSiblingSelector) Specificity() Specificity {
+	return gs.previous.Specificity().Add(gs.next.Specificity())
+}
+
+type UniversalSelector struct{}
+
+func (us *UniversalSelector) Matches(node *model.Node) bool {
+	return node.Type == model.Element
+}
+
+func (us *UniversalSelector) Specificity() Specificity {
+	return Specificity{}
+}
+
+type IDSelector struct {
+	id string
+}
+
+func (is *IDSelector) Matches(node *model.Node) bool {
+	return node.Type == model.Element && node.Attrs["id"] == is.id
+}
+
+func (is *IDSelector) Specificity() Specificity {
+	return Specificity{1, 0, 0}
+}
+
+type ClassSelector struct {
+	class string
+}
+
+func (cs *ClassSelector) Matches(node *model.Node) bool {
+	return node.Type == model.Element && node.HasClass(cs.class)
+}
+
+func (cs *ClassSelector) Specificity() Specificity {
+	return Specificity{0, 1, 0}
+}
+
+// AttributeSelector matches [name], [name=value], [name~=value], [name|=value],
+// [name^=value], [name$=value] and [name*=value]. Like TagSelector, the
+// name is case-sensitive for XML.
+type AttributeSelector struct {
+	name            string // as written
+	lower           string
+	op              string // empty when only the presence is tested
+	value           string
+	caseInsensitive bool
+}
+
+func (as *AttributeSelector) Matches(node *model.Node) bool {
+	if node.Type != model.Element {
+		return false
+	}
+	name := as.name
+	if node.Namespace == "" {
+		name = as.lower
+	}
+	actual, ok := node.Attrs[name]
+	if !ok {
+		return false
+	}
+	value := as.value
+	if as.caseInsensitive {
+		actual = strings.ToLower(actual)
+		value = strings.ToLower(value)
+	}
+	switch as.op {
+	case "":
+		return true
+	case "=":
+		return actual == value
+	case "~=":
+		for _, word := range strings.Fields(actual) {
+			if word == value {
+				return true
+			}
+		}
+		return false
+	case "|=":
+		return actual == value || strings.HasPrefix(actual, value+"-")
+	case "^=":
+		return value != "" && strings.HasPrefix(actual, value)
+	case "$=":
+		return value != "" && strings.HasSuffix(actual, value)
+	case "*=":
+		return value != "" && strings.Contains(actual, value)
+	}
+	return false
+}
+
+func (as *AttributeSelector) Specificity() Specificity {
+	return Specificity{0, 1, 0}
+}
+
+// CompoundSelector matches when all of its simple selectors match, like p.intro.
+type CompoundSelector struct {
+	selectors []Selector
+}
+
+func (cs *CompoundSelector) Matches(node *model.Node) bool {
+	for _, s := range cs.selectors {
+		if !s.Matches(node) {
+			return false
+		}
+	}
+	return true
+}
+
+func (cs *CompoundSelector) Specificity() Specificity {
+	specificity := Specificity{}
+	for _, s := range cs.selectors {
+		specificity = specificity.Add(s.Specificity())
+	}
+	return specificity
+}
+
+// PseudoElementSelector matches the box generated by a pseudo-element,
+// like ::before, for the elements matching element.
+// https://www.w3.org/TR/selectors-4/#pseudo-elements
+type PseudoElementSelector struct {
+	element Selector
+	name    string
+}
+
+func (ps *PseudoElementSelector) Matches(node *model.Node) bool {
+	return node.Pseudo == ps.name && node.Parent != nil && ps.element.Matches(node.Parent)
+}
+
+func (ps *PseudoElementSelector) Specificity() Specificity {
+	return ps.element.Specificity().Add(Specificity{0, 0, 1})
+}
+
+// pseudoElements are the supported pseudo-elements, with whether they
+// can be written with a single colon like CSS 2 did.
+var pseudoElements = map[string]bool{
+	"before": true,
+	"after":  true,
+	"marker": false,
+}
+
+// selectorParser interprets component values, such as the prelude of a qualified rule, as a selector.
+type selectorParser struct {
+	values []ComponentValue
+	i      int
+	pseudo string // the pseudo-element, which ends the selector
+}
+
+// parseSelectorList parses comma separated complex selectors. An invalid
+// selector makes the whole list invalid.
+func parseSelectorList(values []ComponentValue) ([]Selector, error) {
+	ret := []Selector{}
+	for _, part := range splitByComma(values) {
+		s, err := parseSelector(trimWhitespace(part))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, s)
+	}
+	return ret, nil
+}
+
+func parseSelector(values []ComponentValue) (Selector, error) {
+	p := &selectorParser{values: values}
+	return p.complex()
+}
+
+func (p *selectorParser) peek() ComponentValue {
+	if p.i >= len(p.values) {
+		return ComponentValue{Token: Token{Type: EOFToken}}
+	}
+	return p.values[p.i]
+}
+
+func (p *selectorParser) next() ComponentValue {
+	v := p.peek()
+	if p.i < len(p.values) {
+		p.i++
+	}
+	return v
+}
+
+func (p *selectorParser) skipWhitespace() bool {
+	skipped := false
+	for p.peek().Is(WhitespaceToken) {
+		p.i++
+		skipped = true
+	}
+	return skipped
+}
+
+// complex parses compound selectors joined by combinators. The tree is
+// built left-associatively, so matching goes from the rightmost compound
+// selector to the left.
+func (p *selectorParser) complex() (Selector, error) {
+	p.skipWhitespace()
+	ret, err := p.compound()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		hasSpace := p.skipWhitespace()
+		if p.peek().Is(EOFToken) {
+			if p.pseudo != "" {
+				ret = &PseudoElementSelector{element: ret, name: p.pseudo}
+			}
+			return ret, nil
+		}
+		if p.pseudo != "" {
+			return nil, errors.New("pseudo-element ::" + p.pseudo + " must end the selector")
+		}
+		combinator := " "
+		if v := p.peek(); v.IsDelim(">") || v.IsDelim("+") || v.IsDelim("~") {
+			combinator = v.Token.Value
+			p.next()
+			p.skipWhitespace()
+		} else if !hasSpace {
+			return nil, errors.New("unexpected " + v.String() + " in selector")
+		}
+		right, err := p.compound()
+		if err != nil {
+			return nil, err
+		}
+		switch combinator {
+		case ">":
+			ret = &ChildSelector{parent: ret, child: right}
+		case "+":
+			ret = &AdjacentSiblingSelector{previous: ret, next: right}
+		case "~":
+			ret = &GeneralSiblingSelector{previous: ret, next: right}
+		default:
+			ret = &DescendantSelector{ancestor: ret, descendant: right}
+		}
+	}
+}
+
+func (p *selectorParser) compound() (Selector, error) {
+	selectors := []Selector{}
+	switch v := p.peek(); {
+	case v.Is(IdentToken):
+		p.next()
+		selectors = append(selectors, newTagSelector(v.Token.Value))
+	case v.IsDelim("*"):
+		p.next()
+		selectors = append(selectors, &UniversalSelector{})
+	}
+	for {
+		v := p.peek()
+		switch {
+		case v.Is(HashToken) && v.Token.IsID:
+			p.next()
+			selectors = append(selectors, &IDSelector{id: v.Token.Value})
+		case v.IsDelim("."):
+			p.next()
+			name := p.next()
+			if !name.Is(IdentToken) {
+				return nil, errors.New("expected class name after .")
+			}
+			selectors = append(selectors, &ClassSelector{class: name.Token.Value})
+		case v.Is(LeftBracketToken):
+			p.next()
+			attr, err := parseAttributeSelector(v.Children)
+			if err != nil {
+				return nil, err
+			}
+			selectors = append(selectors, attr)
+		case v.Is(ColonToken) && p.pseudo != "":
+			return nil, errors.New("unexpected : after ::" + p.pseudo)
+		case v.Is(ColonToken) && p.isPseudoElement():
+			name, err := p.pseudoElement()
+			if err != nil {
+				return nil, err
+			}
+			p.pseudo = name
+		case v.Is(ColonToken):
+			p.next()
+			pseudo, err := p.pseudoClass()
+			if err != nil {
+				return nil, err
+			}
+			selectors = append(selectors, pseudo)
+		default:
+			if len(selectors) == 0 && p.pseudo != "" {
+				// ::before alone applies to every element
+				selectors = append(selectors, &UniversalSelector{})
+			}
+			if len(selectors) == 0 {
+				if v.Is(EOFToken) {
+					return nil, errors.New("expected selector")
+				}
+				return nil, errors.New("unexpected " + v.String() + " in selector")
+			}
+			if len(selectors) == 1 {
+				return selectors[0], nil
+			}
+			return &CompoundSelector{selectors: selectors}, nil
+		}
+	}
+}
+
+// isPseudoElement reports whether the colon at the current position starts
+// a pseudo-element, either with two colons or one of the CSS 2 ones.
+func (p *selectorParser) isPseudoElement() bool {
+	if p.i+1 >= len(p.values) {
+		return false
+	}
+	next := p.values[p.i+1]
+	return next.Is(ColonToken) || next.Is(IdentToken) && pseudoElements[strings.ToLower(next.Token.Value)]
+}
+
+// pseudoElement parses a pseudo-element from its first colon.
+func (p *selectorParser) pseudoElement() (string, error) {
+	p.next()
+	if p.peek().Is(ColonToken) {
+		p.next()
+	}
+	v := p.next()
+	if !v.Is(IdentToken) {
+		return "", errors.New("unexpected " + v.String() + " after ::")
+	}
+	name := strings.ToLower(v.Token.Value)
+	if _, ok := pseudoElements[name]; !ok {
+		return "", errors.New("unknown pseudo-element ::" + name)
+	}
+	return name, nil
+}
+
+func parseAttributeSelector(values []ComponentValue) (Selector, error) {
+	p := &selectorParser{values: values}
+	p.skipWhitespace()
+	name := p.next()
+	if !name.Is(IdentToken) {
+		return nil, errors.New("expected attribute name")
+	}
+	ret := &AttributeSelector{name: name.Token.Value, lower: strings.ToLower(name.Token.Value)}
+	p.skipWhitespace()
+	if p.peek().Is(EOFToken) {
+		return ret, nil
+	}
+
+	op := p.next()
+	switch {
+	case op.IsDelim("="):
+		ret.op = "="
+	case op.IsDelim("~"), op.IsDelim("|"), op.IsDelim("^"), op.IsDelim("$"), op.IsDelim("*"):
+		if !p.next().IsDelim("=") {
+			return nil, errors.New("expected = in attribute selector")
+		}
+		ret.op = op.Token.Value + "="
+	default:
+		return nil, errors.New("unexpected " + op.String() + " in attribute selector")
+	}
+
+	p.skipWhitespace()
+	value := p.next()
+	if !value.Is(IdentToken) && !value.Is(StringToken) {
+		return nil, errors.New("expected attribute value")
+	}
+	ret.value = value.Token.Value
+
+	p.skipWhitespace()
+	if modifier := p.next(); modifier.IsIdent("i") {
+		ret.caseInsensitive = true
+	} else if !modifier.IsIdent("s") && !modifier.Is(EOFToken) {
+		return nil, errors.New("unexpected " + modifier.String() + " in attribute selector")
+	}
+	p.skipWhitespace()
+	if !p.peek().Is(EOFToken) {
+		return nil, errors.New("unexpected " + p.peek().String() + " in attribute selector")
+	}
+	return ret, nil
 }
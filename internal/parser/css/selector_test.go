@@ -0,0 +1,324 @@
+package css
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pishiko/tenmusu/internal/parser/html"
+	"github.com/pishiko/tenmusu/internal/parser/model"
+	"github.com/pishiko/tenmusu/internal/parser/xml"
+)
+
+const combinatorDocument = `<div id="outer" class="box">
+	<p id="first">one</p>
+	text
+	<p id="second" class="note">two <span id="inner">three</span></p>
+	<!-- comment -->
+	<ul id="list"><li id="item">four</li></ul>
+</div>
+<section id="section"><p id="lonely">five</p></section>`
+
+// matchTest is whether selector matches the element with the id.
+type matchTest struct {
+	selector string
+	id       string
+	want     bool
+}
+
+func checkMatches(t *testing.T, doc *model.Node, tests []matchTest) {
+	t.Helper()
+	for _, test := range tests {
+		selector, err := ParseSelector(test.selector)
+		if err != nil {
+			t.Errorf("%s: %v", test.selector, err)
+			continue
+		}
+		node := doc.GetElementByID(test.id)
+		if node == nil {
+			t.Fatalf("no element #%s", test.id)
+		}
+		if got := selector.Matches(node); got != test.want {
+			t.Errorf("%s on #%s = %v, want %v", test.selector, test.id, got, test.want)
+		}
+	}
+}
+
+func TestSimpleSelectors(t *testing.T) {
+	doc := html.Parse(`<div id="box" class="a b" lang="en-US" title="Hello World" data-empty="">
+	<p id="p" class="b"></p><input id="in" type="Checkbox" checked></div>`)
+	checkMatches(t, doc, []matchTest{
+		{"*", "box", true},
+		{"div", "box", true},
+		{"p", "box", false},
+		{"#box", "box", true},
+		{"#Box", "box", false},
+		{".a", "box", true},
+		{".a.b", "box", true},
+		{".a.c", "box", false},
+		{".b", "p", true},
+		{"div.a#box", "box", true},
+		{"p.a", "p", false},
+		{"*.b", "p", true},
+		// attributes
+		{"[title]", "box", true},
+		{"[checked]", "in", true},
+		{"[checked]", "p", false},
+		{"[title='Hello World']", "box", true},
+		{"[title=hello]", "box", false},
+		{"[title~=World]", "box", true},
+		{"[title~=Wor]", "box", false},
+		{"[lang|=en]", "box", true},
+		{"[lang|=en-U]", "box", false},
+		{"[title^=Hell]", "box", true},
+		{"[title$=rld]", "box", true},
+		{"[title*='o W']", "box", true},
+		{"[data-empty^='']", "box", false},
+		{"[data-empty='']", "box", true},
+		{"[type=checkbox]", "in", false},
+		{"[type=checkbox i]", "in", true},
+		{"input[type][checked]", "in", true},
+	})
+}
+
+func TestSpecificity(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     Specificity
+	}{
+		{"*", Specificity{0, 0, 0}},
+		{"li", Specificity{0, 0, 1}},
+		{"ul li", Specificity{0, 0, 2}},
+		{".a", Specificity{0, 1, 0}},
+		{"[href]", Specificity{0, 1, 0}},
+		{"#x", Specificity{1, 0, 0}},
+		{"div#x.a.b[title]", Specificity{1, 3, 1}},
+		{"ul > li + li ~ .a", Specificity{0, 1, 3}},
+	}
+	for _, test := range tests {
+		selector, err := ParseSelector(test.selector)
+		if err != nil {
+			t.Fatalf("%s: %v", test.selector, err)
+		}
+		if got := selector.Specificity(); got != test.want {
+			t.Errorf("%s: specificity %v, want %v", test.selector, got, test.want)
+		}
+	}
+}
+
+func TestCombinators(t *testing.T) {
+	doc := html.Parse(combinatorDocument)
+	tests := []matchTest{
+		// descendant
+		{"div span", "inner", true},
+		{"div li", "item", true},
+		{".box p", "first", true},
+		{"section span", "inner", false},
+		{"div p", "lonely", false},
+		// the ancestor part is matched against an ancestor, not the element itself
+		{"span span", "inner", false},
+		{"p span", "inner", true},
+		{"span p", "second", false},
+		{"div div", "outer", false},
+		// child
+		{"div > p", "first", true},
+		{"div > span", "inner", false},
+		{"p > span", "inner", true},
+		{"ul > li", "item", true},
+		{"div > li", "item", false},
+		{"div > ul > li", "item", true},
+		// adjacent sibling, skipping text and comments
+		{"#first + p", "second", true},
+		{"#first + ul", "list", false},
+		{"p + ul", "list", true},
+		{"p + p", "first", false},
+		{"div + section", "section", true},
+		// general sibling
+		{"#first ~ ul", "list", true},
+		{"#second ~ p", "first", false},
+		{"p ~ p", "second", true},
+		{"ul ~ p", "second", false},
+		// combined right to left
+		{"div > p + p span", "inner", true},
+		{"div > p ~ ul > li", "item", true},
+		{"section > p ~ ul li", "item", false},
+		{"div p + .note > span", "inner", true},
+	}
+	checkMatches(t, doc, tests)
+}
+
+func TestSiblingsAfterMutation(t *testing.T) {
+	doc := html.Parse(`<ul><li id="a"></li><li id="b"></li><li id="c"></li></ul>`)
+	a, b, c := doc.GetElementByID("a"), doc.GetElementByID("b"), doc.GetElementByID("c")
+	selector, _ := ParseSelector("#a + li")
+	if !selector.Matches(b) {
+		t.Fatalf("#a + li does not match #b")
+	}
+	if err := a.Parent.RemoveChild(b); err != nil {
+		t.Fatal(err)
+	}
+	if !selector.Matches(c) {
+		t.Errorf("#a + li does not match #c after #b is removed")
+	}
+	first, _ := ParseSelector("li:first-child")
+	if err := a.Parent.InsertBefore(b, a); err != nil {
+		t.Fatal(err)
+	}
+	if !first.Matches(b) || first.Matches(a) {
+		t.Errorf("li:first-child does not follow the insertion of #b")
+	}
+}
+
+func TestNameCase(t *testing.T) {
+	htmlDoc := html.Parse(`<div id="h" data-x="1"></div>`)
+	svgDoc, _ := xml.Parse(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 1 1"><foreignObject id="f"/></svg>`, "")
+	tests := []struct {
+		selector string
+		doc      *model.Node
+		id       string
+		want     bool
+	}{
+		// HTML names are case-insensitive
+		{"div", htmlDoc, "h", true},
+		{"DIV", htmlDoc, "h", true},
+		{"[DATA-X]", htmlDoc, "h", true},
+		// XML names are not
+		{"foreignObject", svgDoc, "f", true},
+		{"foreignobject", svgDoc, "f", false},
+		{"svg > foreignObject", svgDoc, "f", true},
+		{"[viewBox] foreignObject", svgDoc, "f", true},
+		{"[viewbox] foreignObject", svgDoc, "f", false},
+		{"foreignObject:first-of-type", svgDoc, "f", true},
+	}
+	for _, test := range tests {
+		selector, err := ParseSelector(test.selector)
+		if err != nil {
+			t.Fatalf("%s: %v", test.selector, err)
+		}
+		if got := selector.Matches(test.doc.GetElementByID(test.id)); got != test.want {
+			t.Errorf("%s on #%s = %v, want %v", test.selector, test.id, got, test.want)
+		}
+	}
+}
+
+func TestPseudoClasses(t *testing.T) {
+	doc := html.Parse(`<ul id="list">
+	<li id="i1"></li><li id="i2">text</li><p id="p1"></p><li id="i3"><!-- c --></li><li id="i4"><b id="only"></b></li>
+</ul><a id="link" href="/a">a</a><a id="anchor">b</a>`)
+	doc.GetElementByID("i2").State |= model.StateHover
+	checkMatches(t, doc, []matchTest{
+		{"li:first-child", "i1", true},
+		{"li:first-child", "i2", false},
+		{"li:last-child", "i4", true},
+		{"b:only-child", "only", true},
+		{"li:only-child", "i1", false},
+		{"li:first-of-type", "i1", true},
+		{"p:first-of-type", "p1", true},
+		{"p:only-of-type", "p1", true},
+		{"li:last-of-type", "i4", true},
+		{"li:empty", "i1", true},
+		{"li:empty", "i3", true},
+		{"li:empty", "i2", false},
+		{"li:empty", "i4", false},
+		// nth
+		{"li:nth-child(2)", "i2", true},
+		{"li:nth-child(odd)", "i1", true},
+		{"li:nth-child(odd)", "i3", false},
+		{"li:nth-child(even)", "i3", true},
+		{"li:nth-child(even)", "i4", false},
+		{"li:nth-child(2n+1)", "i3", false},
+		{"p:nth-child(3)", "p1", true},
+		{"li:nth-child(-n+2)", "i2", true},
+		{"li:nth-child(-n+2)", "i3", false},
+		{"li:nth-last-child(1)", "i4", true},
+		{"li:nth-of-type(3)", "i3", true},
+		{"li:nth-last-of-type(4)", "i1", true},
+		{"li:nth-child(2 of li)", "i2", true},
+		{"li:nth-child(3 of li)", "i3", true},
+		// logical
+		{"li:not(#i1)", "i2", true},
+		{"li:not(#i1, #i2)", "i2", false},
+		{":is(p, li)", "p1", true},
+		{":where(p, li):first-child", "i1", true},
+		// dynamic
+		{"a:link", "link", true},
+		{"a:any-link", "anchor", false},
+		{"li:hover", "i2", true},
+		{"li:hover", "i1", false},
+		{"li:active", "i2", false},
+	})
+	if root := doc.QuerySelector(mustSelector(t, ":root")); root != doc.GetElementByID("list") {
+		t.Errorf(":root matches %v, want the first element of the document", root)
+	}
+}
+
+func TestPseudoClassSpecificity(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     Specificity
+	}{
+		{"li:first-child", Specificity{0, 1, 1}},
+		{":not(#a, .b)", Specificity{1, 0, 0}},
+		{":is(p, .b)", Specificity{0, 1, 0}},
+		{":where(#a, .b)", Specificity{0, 0, 0}},
+		{":nth-child(2 of .b)", Specificity{0, 2, 0}},
+	}
+	for _, test := range tests {
+		if got := mustSelector(t, test.selector).Specificity(); got != test.want {
+			t.Errorf("%s: specificity %v, want %v", test.selector, got, test.want)
+		}
+	}
+}
+
+func mustSelector(t *testing.T, s string) Selector {
+	t.Helper()
+	selector, err := ParseSelector(s)
+	if err != nil {
+		t.Fatalf("%s: %v", s, err)
+	}
+	return selector
+}
+
+func TestSelectorList(t *testing.T) {
+	tests := []struct {
+		css  string
+		want []Specificity // nil when the rule is dropped
+	}{
+		{"h1, h2 { color: red }", []Specificity{{0, 0, 1}, {0, 0, 1}}},
+		{"body,p.a , #x li{ color: red }", []Specificity{{0, 0, 1}, {0, 1, 1}, {1, 0, 1}}},
+		{"h1, h2:unknown { color: red }", nil},
+		{"h1, { color: red }", nil},
+		{", h1 { color: red }", nil},
+		{"h1,, h2 { color: red }", nil},
+	}
+	for _, test := range tests {
+		rules, diagnostics := CSSParseFile("", test.css+" p { color: blue }", AuthorOrigin)
+		if test.want == nil {
+			if len(rules) != 1 || len(diagnostics) != 1 || diagnostics[0].Code != "invalid-selector" {
+				t.Errorf("%q: got %d rules and %v, want the rule dropped", test.css, len(rules), diagnostics)
+			}
+			continue
+		}
+		if len(rules) != 2 || len(diagnostics) != 0 {
+			t.Errorf("%q: got %d rules and %v", test.css, len(rules), diagnostics)
+			continue
+		}
+		got := []Specificity{}
+		for _, s := range rules[0].Selectors {
+			got = append(got, s.Specificity())
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: specificities %v, want %v", test.css, got, test.want)
+		}
+	}
+}
+
+func TestGroupedRule(t *testing.T) {
+	doc := styleDocument(`<h1 id="h">a</h1><p id="p" class="a">b</p><div id="d">c</div>`,
+		sheet(AuthorOrigin, "h1, p { color: blue } .a, div { color: green } p { color: red }"))
+	checkStyles(t, "grouped", doc, []styleTest{
+		{"h", "color", "blue"},
+		// .a is more specific than the later p
+		{"p", "color", "green"},
+		{"d", "color", "green"},
+	})
+}
@@ -0,0 +1,555 @@
+package css
+
+import (
+	"errors"
+	"strings"
+)
+
+// shorthand expands the value of a shorthand property into its longhands.
+// https://www.w3.org/TR/css-cascade-4/#shorthand
+type shorthand struct {
+	longhands []string
+	// expand returns the values of the longhands in order, nil for the ones left out.
+	// Longhands left out are set to their initial value.
+	expand func(items []ComponentValue) ([][]ComponentValue, error)
+}
+
+var shorthands = map[string]shorthand{}
+
+func init() {
+	sides := []string{"top", "right", "bottom", "left"}
+	shorthands["margin"] = boxShorthand(prefixed("margin-", sides, ""), isBoxLength)
+	shorthands["padding"] = boxShorthand(prefixed("padding-", sides, ""), isLengthPercentage)
+	shorthands["border-width"] = boxShorthand(prefixed("border-", sides, "-width"), isLineWidth)
+	shorthands["border-style"] = boxShorthand(prefixed("border-", sides, "-style"), isLineStyle)
+	shorthands["border-color"] = boxShorthand(prefixed("border-", sides, "-color"), isColor)
+	for _, side := range sides {
+		shorthands["border-"+side] = shorthand{
+			longhands: prefixed("border-"+side+"-", []string{"width", "style", "color"}, ""),
+			expand:    expandBorder,
+		}
+	}
+	border := shorthand{
+		expand: func(items []ComponentValue) ([][]ComponentValue, error) {
+			values, err := expandBorder(items)
+			if err != nil {
+				return nil, err
+			}
+			ret := [][]ComponentValue{}
+			for range sides {
+				ret = append(ret, values...)
+			}
+			return ret, nil
+		},
+	}
+	for _, side := range sides {
+		border.longhands = append(border.longhands, prefixed("border-"+side+"-", []string{"width", "style", "color"}, "")...)
+	}
+	shorthands["border"] = border
+	shorthands["border-radius"] = shorthand{
+		longhands: []string{"border-top-left-radius", "border-top-right-radius", "border-bottom-right-radius", "border-bottom-left-radius"},
+		expand:    expandBorderRadius,
+	}
+	shorthands["font"] = shorthand{
+		longhands: []string{"font-style", "font-variant", "font-weight", "font-stretch", "font-size", "line-height", "font-family"},
+		expand:    expandFont,
+	}
+	shorthands["background"] = shorthand{
+		longhands: []string{"background-color", "background-image", "background-position", "background-size", "background-repeat", "background-attachment", "background-origin", "background-clip"},
+		expand:    expandBackground,
+	}
+	shorthands["list-style"] = shorthand{
+		longhands: []string{"list-style-type", "list-style-position", "list-style-image"},
+		expand:    expandListStyle,
+	}
+	shorthands["flex"] = shorthand{
+		longhands: []string{"flex-grow", "flex-shrink", "flex-basis"},
+		expand:    expandFlex,
+	}
+}
+
+func prefixed(prefix string, names []string, suffix string) []string {
+	ret := []string{}
+	for _, name := range names {
+		ret = append(ret, prefix+name+suffix)
+	}
+	return ret
+}
+
+// expandShorthand replaces a shorthand declaration with the declarations
+// of its longhands. Other declarations are returned as they are.
+// inherit, initial, unset and revert on a shorthand apply to all its longhands.
+func expandShorthand(decl Declaration) ([]Declaration, error) {
+	s, ok := shorthands[decl.Name]
+	if !ok {
+		return []Declaration{decl}, nil
+	}
+	items := nonWhitespace(decl.Value)
+	var values [][]ComponentValue
+	if isCSSWideKeyword(items) {
+		for range s.longhands {
+			values = append(values, items)
+		}
+	} else {
+		for _, item := range items {
+			if isCSSWideKeyword([]ComponentValue{item}) {
+				return nil, errors.New(item.Token.Value + " must be alone in " + decl.Name)
+			}
+		}
+		var err error
+		if values, err = s.expand(items); err != nil {
+			return nil, errors.New(err.Error() + " in " + decl.Name)
+		}
+	}
+
+	ret := []Declaration{}
+	for i, name := range s.longhands {
+		value := values[i]
+		if value == nil {
+			value = valuesOf(properties[name].initial)
+		}
+		ret = append(ret, Declaration{
+			Name:      name,
+			Value:     value,
+			Important: decl.Important,
+			Pos:       decl.Pos,
+		})
+	}
+	return ret, nil
+}
+
+// valuesOf parses s as component values.
+func valuesOf(s string) []ComponentValue {
+	return trimWhitespace(newCSSParser("", s).componentValues())
+}
+
+// boxShorthand is a shorthand taking one to four values for the top,
+// right, bottom and left sides.
+func boxShorthand(longhands []string, valid func(ComponentValue) bool) shorthand {
+	return shorthand{
+		longhands: longhands,
+		expand: func(items []ComponentValue) ([][]ComponentValue, error) {
+			if len(items) < 1 || len(items) > 4 {
+				return nil, errors.New("expected one to four values")
+			}
+			for _, item := range items {
+				if !valid(item) {
+					return nil, errors.New("unexpected " + item.String())
+				}
+			}
+			return boxSides(items), nil
+		},
+	}
+}
+
+// boxSides expands one to four values into the values of the four sides.
+func boxSides(items []ComponentValue) [][]ComponentValue {
+	one := func(i int) []ComponentValue {
+		return []ComponentValue{items[i]}
+	}
+	switch len(items) {
+	case 1:
+		return [][]ComponentValue{one(0), one(0), one(0), one(0)}
+	case 2:
+		return [][]ComponentValue{one(0), one(1), one(0), one(1)}
+	case 3:
+		return [][]ComponentValue{one(0), one(1), one(2), one(1)}
+	}
+	return [][]ComponentValue{one(0), one(1), one(2), one(3)}
+}
+
+func isLengthPercentage(v ComponentValue) bool {
+	return v.Is(DimensionToken) || v.Is(PercentageToken) || v.Is(NumberToken) && v.Token.Number == 0 || IsMathFunction(v)
+}
+
+func isBoxLength(v ComponentValue) bool {
+	return isLengthPercentage(v) || v.IsIdent("auto")
+}
+
+func isLineWidth(v ComponentValue) bool {
+	return v.Is(DimensionToken) || v.Is(NumberToken) && v.Token.Number == 0 || IsMathFunction(v) ||
+		v.IsIdent("thin") || v.IsIdent("medium") || v.IsIdent("thick")
+}
+
+func isLineStyle(v ComponentValue) bool {
+	if !v.Is(IdentToken) {
+		return false
+	}
+	switch strings.ToLower(v.Token.Value) {
+	case "none", "hidden", "dotted", "dashed", "solid", "double", "groove", "ridge", "inset", "outset":
+		return true
+	}
+	return false
+}
+
+func isColor(v ComponentValue) bool {
+	if v.IsIdent("currentcolor") {
+		return true
+	}
+	_, ok := parseColor(v)
+	return ok
+}
+
+// anyOrder matches items against the components of a "a || b || c" grammar,
+// each of which takes a single value. It returns the value of each component, nil when absent.
+func anyOrder(items []ComponentValue, components ...func(ComponentValue) bool) ([][]ComponentValue, error) {
+	ret := make([][]ComponentValue, len(components))
+	for _, item := range items {
+		matched := false
+		for i, component := range components {
+			if ret[i] == nil && component(item) {
+				ret[i] = []ComponentValue{item}
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, errors.New("unexpected " + item.String())
+		}
+	}
+	return ret, nil
+}
+
+// expandBorder expands "<line-width> || <line-style> || <color>".
+func expandBorder(items []ComponentValue) ([][]ComponentValue, error) {
+	if len(items) == 0 {
+		return nil, errors.New("expected a value")
+	}
+	return anyOrder(items, isLineWidth, isLineStyle, isColor)
+}
+
+// expandBorderRadius expands "<length-percentage>{1,4} [ / <length-percentage>{1,4} ]?".
+func expandBorderRadius(items []ComponentValue) ([][]ComponentValue, error) {
+	horizontal, vertical := items, []ComponentValue(nil)
+	for i, item := range items {
+		if item.IsDelim("/") {
+			horizontal, vertical = items[:i], items[i+1:]
+			if len(vertical) == 0 {
+				return nil, errors.New("expected values after /")
+			}
+		}
+	}
+	for _, part := range [][]ComponentValue{horizontal, vertical} {
+		if len(part) > 4 {
+			return nil, errors.New("expected one to four values")
+		}
+		for _, item := range part {
+			if !isLengthPercentage(item) {
+				return nil, errors.New("unexpected " + item.String())
+			}
+		}
+	}
+	if len(horizontal) == 0 {
+		return nil, errors.New("expected one to four values")
+	}
+	ret := boxSides(horizontal)
+	if vertical != nil {
+		for i, v := range boxSides(vertical) {
+			ret[i] = append(append(ret[i], ComponentValue{Token: Token{Type: WhitespaceToken}}), v...)
+		}
+	}
+	return ret, nil
+}
+
+var systemFonts = map[string]bool{
+	"caption": true, "icon": true, "menu": true, "message-box": true, "small-caption": true, "status-bar": true,
+}
+
+// expandFont expands "[ <font-style> || <font-variant-css2> || <font-weight> || <font-stretch-css3> ]?
+// <font-size> [ / <line-height> ]? <font-family>".
+// https://www.w3.org/TR/css-fonts-4/#font-prop
+func expandFont(items []ComponentValue) ([][]ComponentValue, error) {
+	ret := make([][]ComponentValue, 7)
+	if len(items) == 1 && items[0].Is(IdentToken) && systemFonts[strings.ToLower(items[0].Token.Value)] {
+		// system fonts are the default font here
+		return ret, nil
+	}
+	i := 0
+	normals := 0
+	for ; i < len(items); i++ {
+		item := items[i]
+		switch {
+		case item.IsIdent("normal"):
+			// normal resets whichever of the properties it stands for
+			normals++
+			continue
+		case ret[0] == nil && (item.IsIdent("italic") || item.IsIdent("oblique")):
+			ret[0] = []ComponentValue{item}
+			continue
+		case ret[1] == nil && item.IsIdent("small-caps"):
+			ret[1] = []ComponentValue{item}
+			continue
+		case ret[2] == nil && isFontWeight(item):
+			ret[2] = []ComponentValue{item}
+			continue
+		case ret[3] == nil && isFontStretch(item):
+			ret[3] = []ComponentValue{item}
+			continue
+		}
+		break
+	}
+	if normals > 4 {
+		return nil, errors.New("too many normal")
+	}
+	if i >= len(items) || !isFontSize(items[i]) {
+		return nil, errors.New("expected font-size")
+	}
+	ret[4] = []ComponentValue{items[i]}
+	i++
+	if i < len(items) && items[i].IsDelim("/") {
+		if i+1 >= len(items) || !(isLengthPercentage(items[i+1]) || items[i+1].Is(NumberToken) || items[i+1].IsIdent("normal")) {
+			return nil, errors.New("expected line-height after /")
+		}
+		ret[5] = []ComponentValue{items[i+1]}
+		i += 2
+	}
+	if i >= len(items) {
+		return nil, errors.New("expected font-family")
+	}
+	family, err := fontFamily(items[i:])
+	if err != nil {
+		return nil, err
+	}
+	ret[6] = family
+	return ret, nil
+}
+
+// fontFamily reads a comma-separated list of family names, each a string
+// or a sequence of identifiers, and joins its parts with whitespace.
+func fontFamily(items []ComponentValue) ([]ComponentValue, error) {
+	if len(items) == 0 {
+		return nil, errors.New("expected font-family")
+	}
+	family := []ComponentValue{}
+	for j, item := range items {
+		switch {
+		case item.Is(CommaToken):
+			family = append(family, item, ComponentValue{Token: Token{Type: WhitespaceToken}})
+		case item.Is(StringToken), item.Is(IdentToken):
+			if j > 0 && !items[j-1].Is(CommaToken) {
+				family = append(family, ComponentValue{Token: Token{Type: WhitespaceToken}})
+			}
+			family = append(family, item)
+		default:
+			return nil, errors.New("unexpected " + item.String() + " in font-family")
+		}
+	}
+	return family, nil
+}
+
+func isFontWeight(v ComponentValue) bool {
+	if v.Is(NumberToken) {
+		return v.Token.Number >= 1 && v.Token.Number <= 1000
+	}
+	return v.IsIdent("bold") || v.IsIdent("bolder") || v.IsIdent("lighter")
+}
+
+func isFontStretch(v ComponentValue) bool {
+	if !v.Is(IdentToken) {
+		return false
+	}
+	switch strings.ToLower(v.Token.Value) {
+	case "ultra-condensed", "extra-condensed", "condensed", "semi-condensed",
+		"semi-expanded", "expanded", "extra-expanded", "ultra-expanded":
+		return true
+	}
+	return false
+}
+
+func isFontSize(v ComponentValue) bool {
+	if isLengthPercentage(v) {
+		return true
+	}
+	if !v.Is(IdentToken) {
+		return false
+	}
+	switch strings.ToLower(v.Token.Value) {
+	case "xx-small", "x-small", "small", "medium", "large", "x-large", "xx-large", "xxx-large", "larger", "smaller":
+		return true
+	}
+	return false
+}
+
+// expandBackground expands the last layer of background, which is the one
+// with the color. Only one layer is supported.
+// https://www.w3.org/TR/css-backgrounds-3/#background
+func expandBackground(items []ComponentValue) ([][]ComponentValue, error) {
+	for _, item := range items {
+		if item.Is(CommaToken) {
+			return nil, errors.New("multiple background layers are not supported")
+		}
+	}
+	ret := make([][]ComponentValue, 8)
+	for i := 0; i < len(items); i++ {
+		item := items[i]
+		switch {
+		case ret[0] == nil && isColor(item):
+			ret[0] = []ComponentValue{item}
+		case ret[1] == nil && isImage(item):
+			ret[1] = []ComponentValue{item}
+		case ret[2] == nil && isPosition(item):
+			// position, then "/ size"
+			j := i
+			for j < len(items) && isPosition(items[j]) {
+				j++
+			}
+			ret[2] = items[i:j]
+			if j < len(items) && items[j].IsDelim("/") {
+				k := j + 1
+				for k < len(items) && (isLengthPercentage(items[k]) || items[k].IsIdent("auto") || items[k].IsIdent("cover") || items[k].IsIdent("contain")) {
+					k++
+				}
+				if k == j+1 {
+					return nil, errors.New("expected background-size after /")
+				}
+				ret[3] = spaced(items[j+1 : k])
+				j = k
+			}
+			ret[2] = spaced(ret[2])
+			i = j - 1
+		case ret[4] == nil && isRepeat(item):
+			j := i + 1
+			if j < len(items) && isRepeat(items[j]) && !item.IsIdent("repeat-x") && !item.IsIdent("repeat-y") {
+				j++
+			}
+			ret[4] = spaced(items[i:j])
+			i = j - 1
+		case ret[5] == nil && (item.IsIdent("scroll") || item.IsIdent("fixed") || item.IsIdent("local")):
+			ret[5] = []ComponentValue{item}
+		case ret[6] == nil && isBox(item):
+			// one box sets both the origin and the clip, two set them in order
+			ret[6] = []ComponentValue{item}
+			if i+1 < len(items) && isBox(items[i+1]) {
+				ret[7] = []ComponentValue{items[i+1]}
+				i++
+			} else {
+				ret[7] = []ComponentValue{item}
+			}
+		default:
+			return nil, errors.New("unexpected " + item.String())
+		}
+	}
+	return ret, nil
+}
+
+func isImage(v ComponentValue) bool {
+	if v.Is(URLToken) || v.IsIdent("none") {
+		return true
+	}
+	if !v.IsFunction() {
+		return false
+	}
+	switch strings.ToLower(v.Token.Value) {
+	case "url", "linear-gradient", "radial-gradient", "conic-gradient",
+		"repeating-linear-gradient", "repeating-radial-gradient", "repeating-conic-gradient", "image-set":
+		return true
+	}
+	return false
+}
+
+func isPosition(v ComponentValue) bool {
+	return isLengthPercentage(v) || v.IsIdent("left") || v.IsIdent("right") || v.IsIdent("top") || v.IsIdent("bottom") || v.IsIdent("center")
+}
+
+func isRepeat(v ComponentValue) bool {
+	if !v.Is(IdentToken) {
+		return false
+	}
+	switch strings.ToLower(v.Token.Value) {
+	case "repeat", "repeat-x", "repeat-y", "no-repeat", "space", "round":
+		return true
+	}
+	return false
+}
+
+func isBox(v ComponentValue) bool {
+	return v.IsIdent("border-box") || v.IsIdent("padding-box") || v.IsIdent("content-box")
+}
+
+// spaced joins items with whitespace, as they are serialized in longhands.
+func spaced(items []ComponentValue) []ComponentValue {
+	ret := []ComponentValue{}
+	for i, item := range items {
+		if i > 0 {
+			ret = append(ret, ComponentValue{Token: Token{Type: WhitespaceToken}})
+		}
+		ret = append(ret, item)
+	}
+	return ret
+}
+
+// expandListStyle expands "<list-style-position> || <list-style-image> || <list-style-type>".
+// none goes to whichever of the type and the image is not given otherwise.
+func expandListStyle(items []ComponentValue) ([][]ComponentValue, error) {
+	nones := 0
+	rest := []ComponentValue{}
+	for _, item := range items {
+		if item.IsIdent("none") {
+			nones++
+		} else {
+			rest = append(rest, item)
+		}
+	}
+	isPosition := func(v ComponentValue) bool {
+		return v.IsIdent("inside") || v.IsIdent("outside")
+	}
+	values, err := anyOrder(rest, isListStyleType, isPosition, isImage)
+	if err != nil {
+		return nil, err
+	}
+	none := []ComponentValue{{Token: Token{Type: IdentToken, Value: "none"}}}
+	switch {
+	case nones > 2, nones == 2 && (values[0] != nil || values[2] != nil), nones == 1 && values[0] != nil && values[2] != nil:
+		return nil, errors.New("unexpected none")
+	case nones == 2:
+		values[0], values[2] = none, none
+	case nones == 1 && values[0] == nil:
+		values[0] = none
+	case nones == 1:
+		values[2] = none
+	}
+	if len(items) == 0 {
+		return nil, errors.New("expected a value")
+	}
+	return values, nil
+}
+
+// expandFlex expands "none | [ <flex-grow> <flex-shrink>? || <flex-basis> ]".
+// https://www.w3.org/TR/css-flexbox-1/#flex-property
+func expandFlex(items []ComponentValue) ([][]ComponentValue, error) {
+	if len(items) == 1 {
+		switch {
+		case items[0].IsIdent("none"):
+			return [][]ComponentValue{valuesOf("0"), valuesOf("0"), valuesOf("auto")}, nil
+		case items[0].IsIdent("auto"):
+			return [][]ComponentValue{valuesOf("1"), valuesOf("1"), valuesOf("auto")}, nil
+		}
+	}
+	isBasis := func(v ComponentValue) bool {
+		return isLengthPercentage(v) || v.IsIdent("auto") || v.IsIdent("content")
+	}
+	// a unitless zero is a flex factor unless two of them come before it
+	ret := [][]ComponentValue{valuesOf("1"), valuesOf("1"), nil}
+	i := 0
+	if len(items) > 0 && !items[0].Is(NumberToken) && isBasis(items[0]) {
+		ret[2] = items[:1]
+		i++
+	}
+	factors := 0
+	for ; i < len(items) && factors < 2 && items[i].Is(NumberToken); i++ {
+		ret[factors] = items[i : i+1]
+		factors++
+	}
+	if ret[2] == nil && i < len(items) && isBasis(items[i]) {
+		ret[2] = items[i : i+1]
+		i++
+	}
+	if i != len(items) || len(items) == 0 {
+		return nil, errors.New("expected flex factors and a basis")
+	}
+	if ret[2] == nil {
+		// flex: <grow> means a basis of 0 rather than the initial auto
+		ret[2] = valuesOf("0%")
+	}
+	return ret, nil
+}
@@ -0,0 +1,110 @@
+package css
+
+import (
+	"reflect"
+	"testing"
+)
+
+// expand expands the declaration "name: value" into its longhands, serialized.
+func expand(name, value string) (map[string]string, error) {
+	decls, err := expandShorthand(Declaration{Name: name, Value: valuesOf(value)})
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]string{}
+	for _, decl := range decls {
+		ret[decl.Name] = Serialize(decl.Value)
+	}
+	return ret, nil
+}
+
+func TestExpandShorthand(t *testing.T) {
+	tests := []struct {
+		name, value string
+		want        map[string]string
+	}{
+		{"font", "bold 16px/1.5 serif", map[string]string{
+			"font-style": "normal", "font-variant": "normal", "font-weight": "bold", "font-stretch": "normal",
+			"font-size": "16px", "line-height": "1.5", "font-family": "serif",
+		}},
+		{"font", `italic small-caps 300 condensed 2em "Helvetica Neue", sans-serif`, map[string]string{
+			"font-style": "italic", "font-variant": "small-caps", "font-weight": "300", "font-stretch": "condensed",
+			"font-size": "2em", "line-height": "normal", "font-family": `"Helvetica Neue", sans-serif`,
+		}},
+		{"margin", "inherit", map[string]string{
+			"margin-top": "inherit", "margin-right": "inherit", "margin-bottom": "inherit", "margin-left": "inherit",
+		}},
+		{"padding", "UNSET", map[string]string{
+			"padding-top": "UNSET", "padding-right": "UNSET", "padding-bottom": "UNSET", "padding-left": "UNSET",
+		}},
+		{"margin", "1px", map[string]string{
+			"margin-top": "1px", "margin-right": "1px", "margin-bottom": "1px", "margin-left": "1px",
+		}},
+		{"margin", "1px auto", map[string]string{
+			"margin-top": "1px", "margin-right": "auto", "margin-bottom": "1px", "margin-left": "auto",
+		}},
+		{"margin", "1px 2px 3px", map[string]string{
+			"margin-top": "1px", "margin-right": "2px", "margin-bottom": "3px", "margin-left": "2px",
+		}},
+		{"padding", "1px 2% calc(1em + 1px) 0", map[string]string{
+			"padding-top": "1px", "padding-right": "2%", "padding-bottom": "calc(1em + 1px)", "padding-left": "0",
+		}},
+		{"border", "2px dashed red", map[string]string{
+			"border-top-width": "2px", "border-top-style": "dashed", "border-top-color": "red",
+			"border-right-width": "2px", "border-right-style": "dashed", "border-right-color": "red",
+			"border-bottom-width": "2px", "border-bottom-style": "dashed", "border-bottom-color": "red",
+			"border-left-width": "2px", "border-left-style": "dashed", "border-left-color": "red",
+		}},
+		{"border-left", "solid", map[string]string{
+			"border-left-width": "medium", "border-left-style": "solid", "border-left-color": "currentcolor",
+		}},
+		{"list-style", "square inside", map[string]string{
+			"list-style-type": "square", "list-style-position": "inside", "list-style-image": "none",
+		}},
+		{"color", "red", map[string]string{"color": "red"}},
+	}
+	for _, test := range tests {
+		got, err := expand(test.name, test.value)
+		if err != nil {
+			t.Errorf("%s: %s: %v", test.name, test.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: %s = %v, want %v", test.name, test.value, got, test.want)
+		}
+	}
+}
+
+func TestExpandShorthandErrors(t *testing.T) {
+	tests := []struct{ name, value string }{
+		{"font", "bold serif"},
+		{"font", "16px"},
+		{"font", "16px/ serif"},
+		{"font", "bold bold 16px serif"},
+		{"margin", "1px 2px 3px 4px 5px"},
+		{"margin", "1px inherit"},
+		{"margin", "red"},
+		{"padding", "1px auto"},
+		{"border", "2px 3px solid"},
+		{"list-style", "square square"},
+	}
+	for _, test := range tests {
+		if got, err := expand(test.name, test.value); err == nil {
+			t.Errorf("%s: %s = %v, want an error", test.name, test.value, got)
+		}
+	}
+}
+
+func TestShorthandCascade(t *testing.T) {
+	doc := styleDocument(`<div id="d" style="margin: 1px 2px; font: italic 20px/30px serif">
+	<p id="p" style="margin: inherit; margin-left: 5px; font: 10px sans-serif; font-style: inherit">a</p></div>`)
+	checkStyles(t, "shorthands", doc, []styleTest{
+		{"p", "margin-top", "1px"},
+		{"p", "margin-right", "2px"},
+		{"p", "margin-left", "5px"},
+		{"p", "font-size", "10px"},
+		{"p", "font-style", "italic"},
+		// reset by the shorthand, though line-height inherits
+		{"p", "line-height", "normal"},
+	})
+}
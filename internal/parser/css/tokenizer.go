@@ -0,0 +1,476 @@
+package css
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Tokenizer implements the tokenization of CSS Syntax Module Level 3.
+// https://www.w3.org/TR/css-syntax-3/#tokenization
+
+type TokenType int
+
+const (
+	IdentToken TokenType = iota
+	FunctionToken
+	AtKeywordToken
+	HashToken
+	StringToken
+	BadStringToken
+	URLToken
+	BadURLToken
+	DelimToken
+	NumberToken
+	PercentageToken
+	DimensionToken
+	WhitespaceToken
+	CDOToken
+	CDCToken
+	ColonToken
+	SemicolonToken
+	CommaToken
+	LeftBracketToken
+	RightBracketToken
+	LeftParenToken
+	RightParenToken
+	LeftBraceToken
+	RightBraceToken
+	EOFToken
+)
+
+type Token struct {
+	Type TokenType
+	// Value is the name of ident, function, at-keyword and hash tokens,
+	// the content of string and url tokens, and the character of a delim token.
+	Value string
+	// Repr is the source text of the number in numeric tokens.
+	Repr    string
+	Number  float64
+	Integer bool
+	Unit    string // dimension tokens only
+	IsID    bool   // hash tokens only, the name would start an identifier
+	Offset  int    // byte offset in the preprocessed source
+}
+
+type Tokenizer struct {
+	s    string
+	i    int
+	last int // size in bytes of the last consumed code point
+
+	// errors reports parse errors at a byte offset.
+	errors func(offset int, code, message string)
+}
+
+// preprocess normalizes newlines and NULs.
+// https://www.w3.org/TR/css-syntax-3/#input-preprocessing
+func preprocess(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	s = strings.ReplaceAll(s, "\f", "\n")
+	return strings.ReplaceAll(s, "\x00", "�")
+}
+
+func NewTokenizer(s string) *Tokenizer {
+	return &Tokenizer{s: s}
+}
+
+// Tokenize returns all tokens of s, ending with an EOF token.
+func (t *Tokenizer) Tokenize() []Token {
+	tokens := []Token{}
+	for {
+		token := t.Next()
+		tokens = append(tokens, token)
+		if token.Type == EOFToken {
+			return tokens
+		}
+	}
+}
+
+func (t *Tokenizer) error(code, message string) {
+	if t.errors != nil {
+		t.errors(t.i, code, message)
+	}
+}
+
+// peek returns the code point n code points ahead, or -1 at the end.
+func (t *Tokenizer) peek(n int) rune {
+	i := t.i
+	for ; n > 0; n-- {
+		if i >= len(t.s) {
+			return -1
+		}
+		_, size := utf8.DecodeRuneInString(t.s[i:])
+		i += size
+	}
+	if i >= len(t.s) {
+		return -1
+	}
+	r, _ := utf8.DecodeRuneInString(t.s[i:])
+	return r
+}
+
+func (t *Tokenizer) consume() rune {
+	if t.i >= len(t.s) {
+		t.last = 0
+		return -1
+	}
+	r, size := utf8.DecodeRuneInString(t.s[t.i:])
+	t.i += size
+	t.last = size
+	return r
+}
+
+// reconsume steps back over r, the code point consumed last. An invalid
+// byte sequence is consumed as U+FFFD, which is longer, so the size is
+// the one consume recorded.
+func (t *Tokenizer) reconsume(r rune) {
+	if r >= 0 {
+		t.i -= t.last
+	}
+}
+
+func (t *Tokenizer) Next() Token {
+	t.comments()
+	start := t.i
+	token := t.next()
+	token.Offset = start
+	return token
+}
+
+func (t *Tokenizer) comments() {
+	for strings.HasPrefix(t.s[t.i:], "/*") {
+		end := strings.Index(t.s[t.i+2:], "*/")
+		if end < 0 {
+			t.error("unterminated-comment", "unterminated comment")
+			t.i = len(t.s)
+			return
+		}
+		t.i += 2 + end + 2
+	}
+}
+
+func (t *Tokenizer) next() Token {
+	r := t.consume()
+	switch {
+	case r < 0:
+		return Token{Type: EOFToken}
+	case isWhitespace(r):
+		for isWhitespace(t.peek(0)) {
+			t.consume()
+		}
+		return Token{Type: WhitespaceToken}
+	case r == '"' || r == '\'':
+		return t.stringToken(r)
+	case r == '#':
+		if isIdentCodePoint(t.peek(0)) || isValidEscape(t.peek(0), t.peek(1)) {
+			isID := wouldStartIdent(t.peek(0), t.peek(1), t.peek(2))
+			return Token{Type: HashToken, Value: t.name(), IsID: isID}
+		}
+		return Token{Type: DelimToken, Value: "#"}
+	case r == '(':
+		return Token{Type: LeftParenToken}
+	case r == ')':
+		return Token{Type: RightParenToken}
+	case r == '[':
+		return Token{Type: LeftBracketToken}
+	case r == ']':
+		return Token{Type: RightBracketToken}
+	case r == '{':
+		return Token{Type: LeftBraceToken}
+	case r == '}':
+		return Token{Type: RightBraceToken}
+	case r == ',':
+		return Token{Type: CommaToken}
+	case r == ':':
+		return Token{Type: ColonToken}
+	case r == ';':
+		return Token{Type: SemicolonToken}
+	case r == '+' || r == '.':
+		if startsNumber(r, t.peek(0), t.peek(1)) {
+			t.reconsume(r)
+			return t.numeric()
+		}
+		return Token{Type: DelimToken, Value: string(r)}
+	case r == '-':
+		if startsNumber(r, t.peek(0), t.peek(1)) {
+			t.reconsume(r)
+			return t.numeric()
+		}
+		if t.peek(0) == '-' && t.peek(1) == '>' {
+			t.consume()
+			t.consume()
+			return Token{Type: CDCToken}
+		}
+		if wouldStartIdent(r, t.peek(0), t.peek(1)) {
+			t.reconsume(r)
+			return t.identLike()
+		}
+		return Token{Type: DelimToken, Value: "-"}
+	case r == '<':
+		if strings.HasPrefix(t.s[t.i:], "!--") {
+			t.i += 3
+			return Token{Type: CDOToken}
+		}
+		return Token{Type: DelimToken, Value: "<"}
+	case r == '@':
+		if wouldStartIdent(t.peek(0), t.peek(1), t.peek(2)) {
+			return Token{Type: AtKeywordToken, Value: t.name()}
+		}
+		return Token{Type: DelimToken, Value: "@"}
+	case r == '\\':
+		if isValidEscape(r, t.peek(0)) {
+			t.reconsume(r)
+			return t.identLike()
+		}
+		t.error("invalid-escape", "invalid escape")
+		return Token{Type: DelimToken, Value: "\\"}
+	case isDigit(r):
+		t.reconsume(r)
+		return t.numeric()
+	case isIdentStart(r):
+		t.reconsume(r)
+		return t.identLike()
+	}
+	return Token{Type: DelimToken, Value: string(r)}
+}
+
+func (t *Tokenizer) numeric() Token {
+	repr, number, integer := t.number()
+	if wouldStartIdent(t.peek(0), t.peek(1), t.peek(2)) {
+		return Token{Type: DimensionToken, Repr: repr, Number: number, Integer: integer, Unit: t.name()}
+	}
+	if t.peek(0) == '%' {
+		t.consume()
+		return Token{Type: PercentageToken, Repr: repr, Number: number, Integer: integer}
+	}
+	return Token{Type: NumberToken, Repr: repr, Number: number, Integer: integer}
+}
+
+func (t *Tokenizer) number() (string, float64, bool) {
+	start := t.i
+	integer := true
+	if r := t.peek(0); r == '+' || r == '-' {
+		t.consume()
+	}
+	t.digits()
+	if t.peek(0) == '.' && isDigit(t.peek(1)) {
+		t.consume()
+		t.digits()
+		integer = false
+	}
+	if r := t.peek(0); r == 'e' || r == 'E' {
+		next := t.peek(1)
+		if isDigit(next) || ((next == '+' || next == '-') && isDigit(t.peek(2))) {
+			t.consume()
+			t.consume()
+			t.digits()
+			integer = false
+		}
+	}
+	repr := t.s[start:t.i]
+	number, _ := strconv.ParseFloat(repr, 64)
+	return repr, number, integer
+}
+
+func (t *Tokenizer) digits() {
+	for isDigit(t.peek(0)) {
+		t.consume()
+	}
+}
+
+func (t *Tokenizer) identLike() Token {
+	name := t.name()
+	if strings.EqualFold(name, "url") && t.peek(0) == '(' {
+		t.consume()
+		for isWhitespace(t.peek(0)) && isWhitespace(t.peek(1)) {
+			t.consume()
+		}
+		next := t.peek(0)
+		if isWhitespace(next) {
+			next = t.peek(1)
+		}
+		if next == '"' || next == '\'' {
+			return Token{Type: FunctionToken, Value: name}
+		}
+		return t.url()
+	}
+	if t.peek(0) == '(' {
+		t.consume()
+		return Token{Type: FunctionToken, Value: name}
+	}
+	return Token{Type: IdentToken, Value: name}
+}
+
+func (t *Tokenizer) url() Token {
+	var b strings.Builder
+	for isWhitespace(t.peek(0)) {
+		t.consume()
+	}
+	for {
+		r := t.consume()
+		switch {
+		case r == ')':
+			return Token{Type: URLToken, Value: b.String()}
+		case r < 0:
+			t.error("eof-in-url", "unexpected end of file in url()")
+			return Token{Type: URLToken, Value: b.String()}
+		case isWhitespace(r):
+			for isWhitespace(t.peek(0)) {
+				t.consume()
+			}
+			if t.peek(0) == ')' || t.peek(0) < 0 {
+				t.consume()
+				return Token{Type: URLToken, Value: b.String()}
+			}
+			t.badURLRemnants()
+			return Token{Type: BadURLToken}
+		case r == '"' || r == '\'' || r == '(' || isNonPrintable(r):
+			t.error("bad-url", "unexpected character in url()")
+			t.badURLRemnants()
+			return Token{Type: BadURLToken}
+		case r == '\\':
+			if isValidEscape(r, t.peek(0)) {
+				b.WriteRune(t.escape())
+				continue
+			}
+			t.error("invalid-escape", "invalid escape in url()")
+			t.badURLRemnants()
+			return Token{Type: BadURLToken}
+		default:
+			b.WriteRune(r)
+		}
+	}
+}
+
+func (t *Tokenizer) badURLRemnants() {
+	for {
+		r := t.consume()
+		if r == ')' || r < 0 {
+			return
+		}
+		if isValidEscape(r, t.peek(0)) {
+			t.escape()
+		}
+	}
+}
+
+func (t *Tokenizer) stringToken(quote rune) Token {
+	var b strings.Builder
+	for {
+		r := t.consume()
+		switch {
+		case r == quote:
+			return Token{Type: StringToken, Value: b.String()}
+		case r < 0:
+			t.error("eof-in-string", "unexpected end of file in string")
+			return Token{Type: StringToken, Value: b.String()}
+		case r == '\n':
+			t.error("newline-in-string", "unexpected newline in string")
+			t.reconsume(r)
+			return Token{Type: BadStringToken}
+		case r == '\\':
+			next := t.peek(0)
+			if next < 0 {
+				continue
+			}
+			if next == '\n' {
+				t.consume()
+				continue
+			}
+			b.WriteRune(t.escape())
+		default:
+			b.WriteRune(r)
+		}
+	}
+}
+
+// escape consumes an escaped code point. The backslash is already consumed.
+func (t *Tokenizer) escape() rune {
+	r := t.consume()
+	if r < 0 {
+		t.error("eof-in-escape", "unexpected end of file in escape")
+		return '�'
+	}
+	if !isHexDigit(r) {
+		return r
+	}
+	hex := string(r)
+	for len(hex) < 6 && isHexDigit(t.peek(0)) {
+		hex += string(t.consume())
+	}
+	if isWhitespace(t.peek(0)) {
+		t.consume()
+	}
+	code, _ := strconv.ParseUint(hex, 16, 32)
+	if code == 0 || (code >= 0xD800 && code <= 0xDFFF) || code > utf8.MaxRune {
+		return '�'
+	}
+	return rune(code)
+}
+
+func (t *Tokenizer) name() string {
+	var b strings.Builder
+	for {
+		r := t.consume()
+		switch {
+		case isIdentCodePoint(r):
+			b.WriteRune(r)
+		case isValidEscape(r, t.peek(0)):
+			b.WriteRune(t.escape())
+		default:
+			t.reconsume(r)
+			return b.String()
+		}
+	}
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func isHexDigit(r rune) bool {
+	return isDigit(r) || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+}
+
+func isWhitespace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n'
+}
+
+func isIdentStart(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r >= 0x80 || r == '_'
+}
+
+func isIdentCodePoint(r rune) bool {
+	return isIdentStart(r) || isDigit(r) || r == '-'
+}
+
+func isNonPrintable(r rune) bool {
+	return (r >= 0 && r <= 0x08) || r == 0x0B || (r >= 0x0E && r <= 0x1F) || r == 0x7F
+}
+
+func isValidEscape(a, b rune) bool {
+	return a == '\\' && b != '\n' && b >= 0
+}
+
+func wouldStartIdent(a, b, c rune) bool {
+	switch {
+	case a == '-':
+		return isIdentStart(b) || b == '-' || isValidEscape(b, c)
+	case isIdentStart(a):
+		return true
+	case a == '\\':
+		return isValidEscape(a, b)
+	}
+	return false
+}
+
+func startsNumber(a, b, c rune) bool {
+	switch {
+	case a == '+' || a == '-':
+		return isDigit(b) || (b == '.' && isDigit(c))
+	case a == '.':
+		return isDigit(b)
+	}
+	return isDigit(a)
+}
@@ -0,0 +1,150 @@
+package css
+
+import "testing"
+
+func TestTokenizeInvalidUTF8(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []Token
+	}{
+		{"ab \xe9x", []Token{{Type: IdentToken, Value: "ab"}, {Type: WhitespaceToken}, {Type: IdentToken, Value: "�x"}}},
+		{"\xe9", []Token{{Type: IdentToken, Value: "�"}}},
+		{"a\xe9 b", []Token{{Type: IdentToken, Value: "a�"}, {Type: WhitespaceToken}, {Type: IdentToken, Value: "b"}}},
+		{"1\xe9", []Token{{Type: DimensionToken, Unit: "�"}}},
+		{"-\xe9", []Token{{Type: IdentToken, Value: "-�"}}},
+		{"'\xe9'", []Token{{Type: StringToken, Value: "�"}}},
+	}
+	for _, test := range tests {
+		tokenizer := NewTokenizer(preprocess(test.input))
+		got := []Token{}
+		// a tokenizer that steps back too far never reaches the end
+		for i := 0; i <= len(test.input); i++ {
+			token := tokenizer.Next()
+			if token.Type == EOFToken {
+				break
+			}
+			got = append(got, token)
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%q: got %d tokens %v, want %d", test.input, len(got), got, len(test.want))
+			continue
+		}
+		for i, token := range got {
+			want := test.want[i]
+			if token.Type != want.Type || token.Value != want.Value || token.Unit != want.Unit {
+				t.Errorf("%q: token %d is %+v, want %+v", test.input, i, token, want)
+			}
+		}
+	}
+}
+
+func TestParseInvalidUTF8(t *testing.T) {
+	rules := CSSParse("p { font-family: caf\xe9; color: red }")
+	if len(rules) != 1 {
+		t.Fatalf("got %d rules, want 1", len(rules))
+	}
+}
+
+// tokenize returns the tokens of input without the EOF token.
+func tokenize(input string) []Token {
+	tokens := NewTokenizer(preprocess(input)).Tokenize()
+	return tokens[:len(tokens)-1]
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []Token
+	}{
+		// strings
+		{`"a b"`, []Token{{Type: StringToken, Value: "a b"}}},
+		{`'a"b'`, []Token{{Type: StringToken, Value: `a"b`}}},
+		{`"a\"b\\"`, []Token{{Type: StringToken, Value: `a"b\`}}},
+		{"\"a\\\nb\"", []Token{{Type: StringToken, Value: "ab"}}},
+		{`"unterminated`, []Token{{Type: StringToken, Value: "unterminated"}}},
+		{"\"a\nb\"", []Token{{Type: BadStringToken}, {Type: WhitespaceToken}, {Type: IdentToken, Value: "b"}, {Type: StringToken}}},
+		// urls
+		{"url(a.png)", []Token{{Type: URLToken, Value: "a.png"}}},
+		{"URL(  a.png  )", []Token{{Type: URLToken, Value: "a.png"}}},
+		{`url(a\)b)`, []Token{{Type: URLToken, Value: "a)b"}}},
+		{`url("a.png")`, []Token{{Type: FunctionToken, Value: "url"}, {Type: StringToken, Value: "a.png"}, {Type: RightParenToken}}},
+		{"url(a b)", []Token{{Type: BadURLToken}}},
+		{"url(a\"b) x", []Token{{Type: BadURLToken}, {Type: WhitespaceToken}, {Type: IdentToken, Value: "x"}}},
+		{"url(a(b)", []Token{{Type: BadURLToken}}},
+		// escapes
+		{`\66 oo`, []Token{{Type: IdentToken, Value: "foo"}}},
+		{`\31 0px`, []Token{{Type: IdentToken, Value: "10px"}}},
+		{`a\:b`, []Token{{Type: IdentToken, Value: "a:b"}}},
+		{`\0`, []Token{{Type: IdentToken, Value: "�"}}},
+		{`\110000`, []Token{{Type: IdentToken, Value: "�"}}},
+		{`#\31 a`, []Token{{Type: HashToken, Value: "1a"}}},
+		{"\\\n", []Token{{Type: DelimToken, Value: `\`}, {Type: WhitespaceToken}}},
+		// numbers
+		{"12", []Token{{Type: NumberToken, Number: 12}}},
+		{"+.5", []Token{{Type: NumberToken, Number: 0.5}}},
+		{"-3.25", []Token{{Type: NumberToken, Number: -3.25}}},
+		{"1e3", []Token{{Type: NumberToken, Number: 1000}}},
+		{"1E-2", []Token{{Type: NumberToken, Number: 0.01}}},
+		{"2e+1%", []Token{{Type: PercentageToken, Number: 20}}},
+		{"50%", []Token{{Type: PercentageToken, Number: 50}}},
+		{"1.5em", []Token{{Type: DimensionToken, Number: 1.5, Unit: "em"}}},
+		{"-2px", []Token{{Type: DimensionToken, Number: -2, Unit: "px"}}},
+		{"1e", []Token{{Type: DimensionToken, Number: 1, Unit: "e"}}},
+		{"1e-x", []Token{{Type: DimensionToken, Number: 1, Unit: "e-x"}}},
+		{`1\65 3`, []Token{{Type: DimensionToken, Number: 1, Unit: "e3"}}},
+		{"1.", []Token{{Type: NumberToken, Number: 1}, {Type: DelimToken, Value: "."}}},
+		{"+-1", []Token{{Type: DelimToken, Value: "+"}, {Type: NumberToken, Number: -1}}},
+		// comments, CDO and CDC
+		{"a/* x */b", []Token{{Type: IdentToken, Value: "a"}, {Type: IdentToken, Value: "b"}}},
+		{"a /* unterminated", []Token{{Type: IdentToken, Value: "a"}, {Type: WhitespaceToken}}},
+		{"<!-- a -->", []Token{{Type: CDOToken}, {Type: WhitespaceToken}, {Type: IdentToken, Value: "a"}, {Type: WhitespaceToken}, {Type: CDCToken}}},
+		{"--> -->x", []Token{{Type: CDCToken}, {Type: WhitespaceToken}, {Type: CDCToken}, {Type: IdentToken, Value: "x"}}},
+		{"--x", []Token{{Type: IdentToken, Value: "--x"}}},
+	}
+	for _, test := range tests {
+		got := tokenize(test.input)
+		if len(got) != len(test.want) {
+			t.Errorf("%q: got %d tokens %+v, want %d", test.input, len(got), got, len(test.want))
+			continue
+		}
+		for i, token := range got {
+			want := test.want[i]
+			if token.Type != want.Type || token.Value != want.Value || token.Number != want.Number || token.Unit != want.Unit {
+				t.Errorf("%q: token %d is %+v, want %+v", test.input, i, token, want)
+			}
+		}
+	}
+}
+
+func TestSerializeRoundTrip(t *testing.T) {
+	tests := []string{
+		`\31 0px`,
+		`-\31 0px`,
+		`\-`,
+		`a\:b c\.d`,
+		`\@media`,
+		`#\31 a #a\ b`,
+		`f\(x\)(1)`,
+		`@\31 x`,
+		`1\65 3 1\65 -2 1e-x`,
+		`10\70 x`,
+		`url(a\)b) url(a\ b) url(a\"b)`,
+		`"a\"b\\c"`,
+		`--x: a\,b`,
+	}
+	for _, test := range tests {
+		want := tokenize(test)
+		serialized := Serialize(newCSSParser("", test).componentValues())
+		got := tokenize(serialized)
+		if len(got) != len(want) {
+			t.Errorf("%q serialized as %q: got %d tokens %+v, want %+v", test, serialized, len(got), got, want)
+			continue
+		}
+		for i, token := range got {
+			w := want[i]
+			if token.Type != w.Type || token.Value != w.Value || token.Number != w.Number || token.Unit != w.Unit {
+				t.Errorf("%q serialized as %q: token %d is %+v, want %+v", test, serialized, i, token, w)
+			}
+		}
+	}
+}
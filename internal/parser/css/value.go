@@ -0,0 +1,225 @@
+package css
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ComponentValue is a preserved token, a function or a simple block.
+// https://www.w3.org/TR/css-syntax-3/#component-value
+type ComponentValue struct {
+	// Token is the preserved token itself, the function token of a function,
+	// or the opening token of a simple block.
+	Token Token
+	// Children are the arguments of a function or the contents of a block.
+	Children []ComponentValue
+}
+
+func (c ComponentValue) IsFunction() bool {
+	return c.Token.Type == FunctionToken
+}
+
+func (c ComponentValue) IsBlock() bool {
+	switch c.Token.Type {
+	case LeftBraceToken, LeftBracketToken, LeftParenToken:
+		return true
+	}
+	return false
+}
+
+// Is reports whether c is the preserved token of type t.
+func (c ComponentValue) Is(t TokenType) bool {
+	return c.Token.Type == t
+}
+
+// IsDelim reports whether c is the delim token d.
+func (c ComponentValue) IsDelim(d string) bool {
+	return c.Token.Type == DelimToken && c.Token.Value == d
+}
+
+// IsIdent reports whether c is an ident token matching name case-insensitively.
+func (c ComponentValue) IsIdent(name string) bool {
+	return c.Token.Type == IdentToken && strings.EqualFold(c.Token.Value, name)
+}
+
+func (c ComponentValue) String() string {
+	var b strings.Builder
+	c.serialize(&b)
+	return b.String()
+}
+
+func (c ComponentValue) serialize(b *strings.Builder) {
+	t := c.Token
+	switch t.Type {
+	case IdentToken:
+		serializeIdent(b, t.Value)
+	case FunctionToken:
+		serializeIdent(b, t.Value)
+		b.WriteString("(")
+		serializeValues(b, c.Children)
+		b.WriteString(")")
+	case AtKeywordToken:
+		b.WriteString("@")
+		serializeIdent(b, t.Value)
+	case HashToken:
+		b.WriteString("#")
+		serializeName(b, t.Value)
+	case StringToken:
+		b.WriteString(quoteString(t.Value))
+	case URLToken:
+		b.WriteString("url(")
+		serializeURL(b, t.Value)
+		b.WriteString(")")
+	case DelimToken:
+		b.WriteString(t.Value)
+	case NumberToken:
+		b.WriteString(t.Repr)
+	case PercentageToken:
+		b.WriteString(t.Repr + "%")
+	case DimensionToken:
+		b.WriteString(t.Repr)
+		serializeUnit(b, t.Unit)
+	case WhitespaceToken:
+		b.WriteString(" ")
+	case CDOToken:
+		b.WriteString("<!--")
+	case CDCToken:
+		b.WriteString("-->")
+	case ColonToken:
+		b.WriteString(":")
+	case SemicolonToken:
+		b.WriteString(";")
+	case CommaToken:
+		b.WriteString(",")
+	case LeftBraceToken:
+		b.WriteString("{")
+		serializeValues(b, c.Children)
+		b.WriteString("}")
+	case LeftBracketToken:
+		b.WriteString("[")
+		serializeValues(b, c.Children)
+		b.WriteString("]")
+	case LeftParenToken:
+		b.WriteString("(")
+		serializeValues(b, c.Children)
+		b.WriteString(")")
+	}
+}
+
+// Serialize turns component values back into CSS text.
+func Serialize(values []ComponentValue) string {
+	var b strings.Builder
+	serializeValues(&b, values)
+	return b.String()
+}
+
+func serializeValues(b *strings.Builder, values []ComponentValue) {
+	for _, v := range values {
+		v.serialize(b)
+	}
+}
+
+// serializeIdent writes s escaped so that it reads back as one ident.
+// https://www.w3.org/TR/cssom-1/#serialize-an-identifier
+func serializeIdent(b *strings.Builder, s string) {
+	if s == "-" {
+		b.WriteString("\\-")
+		return
+	}
+	for i, r := range s {
+		switch {
+		case r >= '0' && r <= '9' && (i == 0 || i == 1 && s[0] == '-'):
+			escapeCodePoint(b, r)
+		default:
+			serializeNameRune(b, r)
+		}
+	}
+}
+
+// serializeName writes s escaped so that it reads back as the name of a
+// hash token, which may start with a digit.
+func serializeName(b *strings.Builder, s string) {
+	for _, r := range s {
+		serializeNameRune(b, r)
+	}
+}
+
+func serializeNameRune(b *strings.Builder, r rune) {
+	switch {
+	case r == 0:
+		b.WriteRune('\uFFFD')
+	case r < 0x20 || r == 0x7F:
+		escapeCodePoint(b, r)
+	case r >= 0x80, r == '-', r == '_', r >= '0' && r <= '9', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		b.WriteRune(r)
+	default:
+		b.WriteByte('\\')
+		b.WriteRune(r)
+	}
+}
+
+// serializeUnit writes the unit of a dimension, which must not read back
+// as the exponent of the number, like the e3 of 1\65 3.
+func serializeUnit(b *strings.Builder, unit string) {
+	if len(unit) >= 2 && (unit[0] == 'e' || unit[0] == 'E') {
+		next := unit[1]
+		if next >= '0' && next <= '9' || (next == '+' || next == '-') && len(unit) >= 3 && unit[2] >= '0' && unit[2] <= '9' {
+			escapeCodePoint(b, rune(unit[0]))
+			serializeName(b, unit[1:])
+			return
+		}
+	}
+	serializeIdent(b, unit)
+}
+
+// serializeURL writes the contents of an unquoted url(), escaping what
+// would end it or make it a bad url.
+func serializeURL(b *strings.Builder, s string) {
+	for _, r := range s {
+		switch {
+		case r <= ' ' || r == 0x7F:
+			escapeCodePoint(b, r)
+		case r == '(' || r == ')' || r == '"' || r == '\'' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+}
+
+// escapeCodePoint writes r as a hexadecimal escape, with the space that ends it.
+func escapeCodePoint(b *strings.Builder, r rune) {
+	b.WriteString("\\" + strconv.FormatInt(int64(r), 16) + " ")
+}
+
+func quoteString(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	s = strings.ReplaceAll(s, "\n", "\\a ")
+	return "\"" + s + "\""
+}
+
+// trimWhitespace removes whitespace tokens at both ends of values.
+func trimWhitespace(values []ComponentValue) []ComponentValue {
+	for len(values) > 0 && values[0].Is(WhitespaceToken) {
+		values = values[1:]
+	}
+	for len(values) > 0 && values[len(values)-1].Is(WhitespaceToken) {
+		values = values[:len(values)-1]
+	}
+	return values
+}
+
+// splitByComma splits values at top-level comma tokens.
+func splitByComma(values []ComponentValue) [][]ComponentValue {
+	ret := [][]ComponentValue{}
+	start := 0
+	for i, v := range values {
+		if v.Is(CommaToken) {
+			ret = append(ret, values[start:i])
+			start = i + 1
+		}
+	}
+	return append(ret, values[start:])
+}
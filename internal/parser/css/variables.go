@@ -0,0 +1,163 @@
+package css
+
+import "strings"
+
+// Custom properties and var() substitution.
+// https://www.w3.org/TR/css-variables-1/
+
+func isCustomProperty(name string) bool {
+	return strings.HasPrefix(name, "--")
+}
+
+// customProperties computes the custom properties of an element from the
+// declarations applying to it, in cascade order, and the ones inherited
+// from its parent. var() references are substituted, and properties
+// referring to themselves through a cycle are dropped.
+func customProperties(decls []cascadedDeclaration, inherited map[string][]ComponentValue) map[string][]ComponentValue {
+	declared := map[string][]ComponentValue{}
+	for _, c := range decls {
+		if isCustomProperty(c.decl.Name) {
+			declared[c.decl.Name] = c.decl.Value
+		}
+	}
+	if len(declared) == 0 {
+		return inherited
+	}
+
+	ret := map[string][]ComponentValue{}
+	for name, value := range inherited {
+		ret[name] = value
+	}
+	for name, value := range declared {
+		if len(value) == 1 && value[0].IsIdent("initial") {
+			delete(ret, name)
+			delete(declared, name)
+		} else if len(value) == 1 && (value[0].IsIdent("inherit") || value[0].IsIdent("unset")) {
+			delete(declared, name)
+		}
+	}
+
+	const (
+		unresolved = iota
+		resolving
+		resolved
+	)
+	state := map[string]int{}
+	cyclic := map[string]bool{}
+	stack := []string{}
+	var resolve func(name string) ([]ComponentValue, bool)
+	resolve = func(name string) ([]ComponentValue, bool) {
+		value, ok := declared[name]
+		if !ok {
+			value, ok = ret[name]
+			return value, ok
+		}
+		switch state[name] {
+		case resolving:
+			// every property from the first visit of name is part of the cycle
+			for i := len(stack) - 1; i >= 0; i-- {
+				cyclic[stack[i]] = true
+				if stack[i] == name {
+					break
+				}
+			}
+			return nil, false
+		case resolved:
+			value, ok = ret[name]
+			return value, ok
+		}
+		state[name] = resolving
+		stack = append(stack, name)
+		value, ok = substitute(value, resolve)
+		stack = stack[:len(stack)-1]
+		state[name] = resolved
+		if ok && !cyclic[name] {
+			ret[name] = value
+		} else {
+			delete(ret, name)
+		}
+		return ret[name], ok && !cyclic[name]
+	}
+	for name := range declared {
+		resolve(name)
+	}
+	return ret
+}
+
+// maxSubstitution is the most component values a substituted value may
+// have, so that properties referring to others many times over, like
+// "--b: var(--a) var(--a)" repeated, cannot grow exponentially.
+// https://www.w3.org/TR/css-variables-1/#long-variables
+const maxSubstitution = 1 << 16
+
+// substitute replaces the var() functions in values with the value of the
+// custom property they refer to, or with their fallback. It fails when a
+// property without fallback cannot be found, or when the value gets longer
+// than maxSubstitution, which makes the declaration invalid at
+// computed-value time.
+func substitute(values []ComponentValue, lookup func(name string) ([]ComponentValue, bool)) ([]ComponentValue, bool) {
+	if !containsVar(values) {
+		return values, true
+	}
+	ret := []ComponentValue{}
+	length := 0
+	for _, v := range values {
+		if length > maxSubstitution {
+			return nil, false
+		}
+		switch {
+		case v.IsFunction() && strings.EqualFold(v.Token.Value, "var"):
+			args := trimWhitespace(v.Children)
+			if len(args) == 0 || !args[0].Is(IdentToken) || !isCustomProperty(args[0].Token.Value) {
+				return nil, false
+			}
+			rest := trimWhitespace(args[1:])
+			if len(rest) > 0 && !rest[0].Is(CommaToken) {
+				return nil, false
+			}
+			if value, ok := lookup(args[0].Token.Value); ok {
+				length += valuesLength(value)
+				ret = append(ret, value...)
+				continue
+			}
+			if len(rest) == 0 {
+				return nil, false
+			}
+			fallback, ok := substitute(trimWhitespace(rest[1:]), lookup)
+			if !ok {
+				return nil, false
+			}
+			length += valuesLength(fallback)
+			ret = append(ret, fallback...)
+		case v.IsFunction() || v.IsBlock():
+			children, ok := substitute(v.Children, lookup)
+			if !ok {
+				return nil, false
+			}
+			length += 1 + valuesLength(children)
+			ret = append(ret, ComponentValue{Token: v.Token, Children: children})
+		default:
+			length++
+			ret = append(ret, v)
+		}
+	}
+	return ret, length <= maxSubstitution
+}
+
+// valuesLength counts values and their descendants.
+func valuesLength(values []ComponentValue) int {
+	n := len(values)
+	for _, v := range values {
+		n += valuesLength(v.Children)
+	}
+	return n
+}
+
+func containsVar(values []ComponentValue) bool {
+	for _, v := range values {
+		if v.IsFunction() && strings.EqualFold(v.Token.Value, "var") || containsVar(v.Children) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package css
+
+import (
+	"reflect"
+	"testing"
+)
+
+// customOf returns the custom properties of declarations in the style
+// attribute syntax, serialized.
+func customOf(style string, inherited map[string][]ComponentValue) map[string]string {
+	decls := []cascadedDeclaration{}
+	for _, decl := range InlineCSSParse(style) {
+		decls = append(decls, cascadedDeclaration{decl: decl, origin: AuthorOrigin, inline: true})
+	}
+	ret := map[string]string{}
+	for name, value := range customProperties(decls, inherited) {
+		ret[name] = Serialize(trimWhitespace(value))
+	}
+	return ret
+}
+
+func TestCustomProperties(t *testing.T) {
+	inherited := map[string][]ComponentValue{"--x": valuesOf("red")}
+	tests := []struct {
+		style string
+		want  map[string]string
+	}{
+		{"--a: 1px; --b: var(--a)", map[string]string{"--x": "red", "--a": "1px", "--b": "1px"}},
+		{"--b: var(--a) var(--a); --a: 1px", map[string]string{"--x": "red", "--a": "1px", "--b": "1px 1px"}},
+		{"--a: var(--x)", map[string]string{"--x": "red", "--a": "red"}},
+		{"--a: var(--missing, 2px)", map[string]string{"--x": "red", "--a": "2px"}},
+		{"--a: var(--missing, var(--x))", map[string]string{"--x": "red", "--a": "red"}},
+		{"--a: var(--missing)", map[string]string{"--x": "red"}},
+		{"--x: initial; --a: var(--x, 3px)", map[string]string{"--a": "3px"}},
+		{"--x: inherit", map[string]string{"--x": "red"}},
+		// cycles
+		{"--a: var(--a)", map[string]string{"--x": "red"}},
+		{"--a: var(--a, 1px)", map[string]string{"--x": "red"}},
+		{"--a: var(--b); --b: var(--a); --c: 1px", map[string]string{"--x": "red", "--c": "1px"}},
+		{"--a: var(--b); --b: var(--c); --c: var(--b)", map[string]string{"--x": "red"}},
+		{"--x: var(--x)", map[string]string{}},
+		// a property outside of the cycle falls back
+		{"--a: var(--b, 4px); --b: var(--c); --c: var(--b)", map[string]string{"--x": "red", "--a": "4px"}},
+	}
+	for _, test := range tests {
+		if got := customOf(test.style, inherited); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %v, want %v", test.style, got, test.want)
+		}
+	}
+}
+
+func TestVarSubstitution(t *testing.T) {
+	doc := styleDocument(`<div id="d" style="color: green; --size: 2em; --loop: var(--loop)">
+	<p id="value" style="color: var(--c); --c: blue">a</p>
+	<p id="missing" style="color: var(--none); margin-top: var(--none, 4px)">b</p>
+	<p id="cycle" style="color: var(--loop, red); margin-top: var(--loop)">c</p>
+	<p id="nested" style="--n: calc(var(--size) * 2); padding-left: var(--n)">d</p></div>`)
+	checkStyles(t, "var()", doc, []styleTest{
+		{"value", "color", "blue"},
+		// invalid at computed-value time, color inherits
+		{"missing", "color", "green"},
+		{"missing", "margin-top", "4px"},
+		// a property of the parent in a cycle is missing, unlike its fallback
+		{"cycle", "color", "red"},
+		{"cycle", "margin-top", "0"},
+		{"nested", "padding-left", "calc(2em * 2)"},
+	})
+	if got := doc.GetElementByID("nested").Computed.Lengths["padding-left"].Px; got != 64 {
+		t.Errorf("padding-left of #nested = %vpx, want 64px", got)
+	}
+}
@@ -0,0 +1,114 @@
+package html
+
+import (
+	"strings"
+
+	"github.com/pishiko/tenmusu/internal/parser/model"
+)
+
+var quirkyPublicIDPrefixes = [...]string{
+	"+//silmaril//dtd html pro v0r11 19970101//",
+	"-//as//dtd html 3.0 aswedit + extensions//",
+	"-//advasoft ltd//dtd html 3.0 aswedit + extensions//",
+	"-//ietf//dtd html 2.0",
+	"-//ietf//dtd html 3",
+	"-//ietf//dtd html level",
+	"-//ietf//dtd html strict",
+	"-//ietf//dtd html//",
+	"-//metrius//dtd metrius presentational//",
+	"-//microsoft//dtd internet explorer",
+	"-//netscape comm. corp.//dtd",
+	"-//o'reilly and associates//dtd html",
+	"-//softquad",
+	"-//spyglass//dtd html 2.0 extended//",
+	"-//sq//dtd html 2.0 hotmetal + extensions//",
+	"-//sun microsystems corp.//dtd hotjava html//",
+	"-//w3c//dtd html 3",
+	"-//w3c//dtd html 4.0 frameset//",
+	"-//w3c//dtd html 4.0 transitional//",
+	"-//w3c//dtd html experimental",
+	"-//w3c//dtd w3 html//",
+	"-//w3o//dtd w3 html 3.0//",
+	"-//webtechs//dtd mozilla html",
+}
+
+// parseDoctype parses the text after "<!DOCTYPE" into a Doctype node.
+// The public and system identifiers are kept in Attrs.
+func parseDoctype(text string) *model.Node {
+	node := &model.Node{Type: model.Doctype, Attrs: map[string]string{}}
+	text = strings.TrimSpace(text)
+	name, rest, _ := strings.Cut(text, " ")
+	node.Value = strings.ToLower(name)
+
+	rest = strings.TrimSpace(rest)
+	keyword, rest, _ := strings.Cut(rest, " ")
+	switch strings.ToUpper(keyword) {
+	case "PUBLIC":
+		publicID, rest, ok := quoted(rest)
+		if !ok {
+			break
+		}
+		node.Attrs["publicId"] = publicID
+		if systemID, _, ok := quoted(rest); ok {
+			node.Attrs["systemId"] = systemID
+		}
+	case "SYSTEM":
+		if systemID, _, ok := quoted(rest); ok {
+			node.Attrs["systemId"] = systemID
+		}
+	}
+	return node
+}
+
+// quoted reads a single or double quoted string at the start of s.
+func quoted(s string) (string, string, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" || (s[0] != '"' && s[0] != '\'') {
+		return "", s, false
+	}
+	end := strings.IndexByte(s[1:], s[0])
+	if end < 0 {
+		return "", s, false
+	}
+	return s[1 : end+1], s[end+2:], true
+}
+
+// documentMode decides the compatibility mode from a doctype.
+// https://html.spec.whatwg.org/multipage/parsing.html#the-initial-insertion-mode
+func documentMode(doctype *model.Node) model.DocumentMode {
+	if doctype.Value != "html" {
+		return model.QuirksMode
+	}
+	publicID, hasPublic := doctype.Attrs["publicId"]
+	systemID, hasSystem := doctype.Attrs["systemId"]
+	publicID = strings.ToLower(publicID)
+	systemID = strings.ToLower(systemID)
+
+	switch publicID {
+	case "-//w3o//dtd w3 html strict 3.0//en//", "-/w3c/dtd html 4.0 transitional/en", "html":
+		return model.QuirksMode
+	}
+	if systemID == "http://www.ibm.com/data/dtd/v11/ibmxhtml1-transitional.dtd" {
+		return model.QuirksMode
+	}
+	if hasPublic {
+		for _, prefix := range quirkyPublicIDPrefixes {
+			if strings.HasPrefix(publicID, prefix) {
+				return model.QuirksMode
+			}
+		}
+	}
+	isHTML401Loose := strings.HasPrefix(publicID, "-//w3c//dtd html 4.01 frameset//") ||
+		strings.HasPrefix(publicID, "-//w3c//dtd html 4.01 transitional//")
+	if isHTML401Loose {
+		if !hasSystem {
+			return model.QuirksMode
+		}
+		return model.LimitedQuirksMode
+	}
+	if strings.HasPrefix(publicID, "-//w3c//dtd xhtml 1.0 frameset//") ||
+		strings.HasPrefix(publicID, "-//w3c//dtd xhtml 1.0 transitional//") {
+		return model.LimitedQuirksMode
+	}
+	return model.NoQuirksMode
+}
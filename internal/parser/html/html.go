@@ -1,138 +1,389 @@
 package html
 
 import (
+	"io"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/pishiko/tenmusu/internal/parser/model"
 	"github.com/pishiko/tenmusu/internal/util"
 )
 
+// Parser is a push-based HTML parser. Chunks of the document are fed
+// with Write as they arrive, and the tree is built incrementally, so
+// Document can be read before the whole body has been received.
 type Parser struct {
-	body       string
 	unfinished util.Stack[*model.Node]
+	document   *model.Node
 	node       *model.Node
+
+	isInTag bool
+	rawText string // name of the open script or style element, whose text has no markup
+	endTag  int    // offset in buf after the last "</" of the raw text, or 0
+	buf     strings.Builder
+	pending []byte // incomplete UTF-8 sequence at the end of the last chunk
+
+	line, column int // position of the next rune
+	start        model.Position
+	diagnostics  []model.Diagnostic
+
+	// File is recorded in the positions of nodes and diagnostics.
+	File string
+	// OnElement is called when the start tag of an element has been parsed.
+	OnElement func(node *model.Node)
 }
 
-func Parse(body string) *model.Node {
+func NewParser() *Parser {
+	document := &model.Node{Type: model.Document, Value: "#document", Mode: model.QuirksMode}
 	parser := &Parser{
-		body:       body,
 		unfinished: util.Stack[*model.Node]{},
+		document:   document,
+		line:       1,
+		column:     1,
 	}
-	parser.parse()
-	return parser.node
+	parser.unfinished.Push(document)
+	return parser
 }
 
-func (p *Parser) parse() {
-	isInTag := false
-	buf := ""
-	for _, char := range p.body {
-		switch char {
-		case '<':
-			isInTag = true
-			if buf != "" {
-				p.addText(buf)
-				buf = ""
-			}
-		case '>':
-			isInTag = false
-			p.addElement(buf)
-			buf = ""
-		default:
-			buf += string(char)
+func Parse(body string) *model.Node {
+	parser := NewParser()
+	parser.Write([]byte(body))
+	return parser.Close()
+}
+
+// ParseReader parses a document from r chunk by chunk.
+func ParseReader(r io.Reader) (*model.Node, error) {
+	parser := NewParser()
+	_, err := io.Copy(parser, r)
+	return parser.Close(), err
+}
+
+// Diagnostics returns the problems found so far.
+func (p *Parser) Diagnostics() []model.Diagnostic {
+	return p.diagnostics
+}
+
+func (p *Parser) report(severity model.Severity, code, message string) {
+	p.diagnostics = append(p.diagnostics, model.Diagnostic{
+		Severity: severity,
+		Code:     code,
+		Pos:      p.start,
+		Message:  message,
+	})
+}
+
+func (p *Parser) position() model.Position {
+	return model.Position{File: p.File, Line: p.line, Column: p.column}
+}
+
+// Document returns the tree parsed so far.
+func (p *Parser) Document() *model.Node {
+	return p.document
+}
+
+func (p *Parser) Write(chunk []byte) (int, error) {
+	data := chunk
+	if len(p.pending) > 0 {
+		data = append(p.pending, chunk...)
+		p.pending = nil
+	}
+	for len(data) > 0 {
+		if !utf8.FullRune(data) {
+			p.pending = append([]byte{}, data...)
+			break
 		}
+		char, size := utf8.DecodeRune(data)
+		data = data[size:]
+		p.feed(char)
+	}
+	return len(chunk), nil
+}
+
+func (p *Parser) feed(char rune) {
+	switch {
+	case p.rawText != "":
+		p.feedRawText(char)
+	case char == '<' && !(p.isInTag && isInComment(p.buf.String())):
+		if p.buf.Len() > 0 {
+			p.addText(p.buf.String())
+			p.buf.Reset()
+		}
+		p.isInTag = true
+		p.start = p.position()
+	case char == '>' && !(p.isInTag && isInComment(p.buf.String())):
+		p.isInTag = false
+		p.addElement(p.buf.String())
+		p.buf.Reset()
+	default:
+		if p.buf.Len() == 0 && !p.isInTag {
+			p.start = p.position()
+		}
+		p.buf.WriteRune(char)
+	}
+
+	if char == '\n' {
+		p.line++
+		p.column = 1
+	} else {
+		p.column++
 	}
-	if !isInTag && buf != "" {
-		p.addText(buf)
+}
+
+// feedRawText feeds the text of a script or style element, which only
+// ends at its end tag.
+func (p *Parser) feedRawText(char rune) {
+	if p.buf.Len() == 0 {
+		p.start = p.position()
 	}
+	p.buf.WriteRune(char)
+	text := p.buf.String()
+	if char == '/' && strings.HasSuffix(text, "</") {
+		p.endTag = len(text)
+		return
+	}
+	if char != '>' || p.endTag == 0 || !strings.EqualFold(strings.TrimRight(text[p.endTag:len(text)-1], " \t\n\r\f"), p.rawText) {
+		return
+	}
+	if i := p.endTag - 2; i > 0 {
+		p.addText(text[:i])
+	}
+	p.buf.Reset()
+	p.endTag = 0
+	name := p.rawText
+	p.rawText = ""
+	p.addElement("/" + name)
+}
+
+// Close finishes parsing and returns the document.
+func (p *Parser) Close() *model.Node {
+	if len(p.pending) > 0 {
+		p.buf.WriteRune(utf8.RuneError)
+		p.pending = nil
+	}
+	if p.isInTag {
+		if isInComment(p.buf.String()) {
+			p.report(model.SeverityError, "eof-in-comment", "Unterminated comment")
+		} else {
+			p.report(model.SeverityError, "eof-in-tag", "Unexpected end of file in tag")
+		}
+	} else if p.buf.Len() > 0 {
+		p.addText(p.buf.String())
+	}
+	p.buf.Reset()
 
 	// finish
 	for node := p.unfinished.Pop(); node != nil; node = p.unfinished.Pop() {
 		p.node = node
 	}
+	return p.node
+}
+
+// isInComment reports whether buf is an unterminated "<!--" comment.
+func isInComment(buf string) bool {
+	if !strings.HasPrefix(buf, "!--") || buf == "!--" {
+		return false
+	}
+	return !strings.HasSuffix(buf[3:], "--")
 }
 
 func (p *Parser) addElement(text string) {
 	if text == "" {
 		return
 	}
-	parts := strings.Split(strings.ReplaceAll(text, "\n", " "), " ")
-	name := parts[0]
+	switch {
+	case strings.HasPrefix(text, "!--"):
+		p.addComment(strings.TrimSuffix(text[3:], "--"))
+		return
+	case len(text) >= 8 && strings.EqualFold(text[:8], "!DOCTYPE"):
+		p.addDoctype(text[8:])
+		return
+	case text[0] == '!':
+		// bogus comment
+		p.addComment(text[1:])
+		return
+	case text[0] == '?':
+		// processing instructions are bogus comments in HTML
+		p.addComment(text)
+		return
+	}
 
-	// attr TODO FIX
-	attrs := make(map[string]string)
-	for _, part := range parts[1:] {
-		if strings.Contains(part, "=") {
-			attrParts := strings.SplitN(part, "=", 2)
-			key := strings.TrimSpace(attrParts[0])
-			value := strings.TrimSpace(attrParts[1])
-			if len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"' {
-				value = value[1 : len(value)-1]
-			}
-			attrs[key] = value
-		}
+	name, attrs := parseTag(text)
+	if name == "" || name == "/" {
+		return
 	}
 
 	if name[0] == '/' {
 		name = name[1:]
-		if node := p.unfinished.Pop(); node != nil {
-			if node.Value != name {
-				println("Mismatched closing tag: " + name + " for " + node.Value)
-			}
-			if parent := p.unfinished.Peek(); parent != nil {
-				parent.Children = append(parent.Children, node)
-			} else {
-				p.node = node
-			}
-		} else {
-			panic("Unmatched closing tag: " + name)
+		open := p.unfinished.Peek()
+		for open != p.document && open.Value != name {
+			open = open.Parent
 		}
-	} else {
-		if name[0] == '!' {
+		if open == p.document {
+			p.report(model.SeverityError, "unmatched-end-tag", "Unmatched closing tag: "+name)
 			return
 		}
+		// close the elements left open inside the matched one
+		for node := p.unfinished.Pop(); node != open; node = p.unfinished.Pop() {
+			p.report(model.SeverityWarning, "mismatched-end-tag", "Mismatched closing tag: "+name+" for "+node.Value)
+		}
+	} else {
+		parent := p.unfinished.Peek()
+		node := &model.Node{Type: model.Element, Value: name, Parent: parent, Attrs: attrs, Pos: p.start}
+		parent.Children = append(parent.Children, node)
+		if p.OnElement != nil {
+			p.OnElement(node)
+		}
 		if isSelefClosingTag(name) {
-			if parent := p.unfinished.Peek(); parent != nil {
-				parent.Children = append(parent.Children, &model.Node{Type: model.Element, Value: name, Parent: parent, Attrs: attrs})
+			return
+		}
+		p.unfinished.Push(node)
+		if isRawText(name) {
+			p.rawText = name
+		}
+	}
+}
+
+// parseTag splits the inside of a tag into its lower-cased name and attributes.
+// Attribute values may be double quoted, single quoted or unquoted.
+func parseTag(text string) (string, map[string]string) {
+	i := 0
+	for i < len(text) && !isSpace(text[i]) && !(text[i] == '/' && i > 0) {
+		i++
+	}
+	name := strings.ToLower(text[:i])
+
+	attrs := make(map[string]string)
+	for i < len(text) {
+		for i < len(text) && (isSpace(text[i]) || text[i] == '/') {
+			i++
+		}
+		start := i
+		for i < len(text) && !isSpace(text[i]) && text[i] != '=' && text[i] != '/' {
+			i++
+		}
+		key := strings.ToLower(text[start:i])
+		for i < len(text) && isSpace(text[i]) {
+			i++
+		}
+		value := ""
+		if i < len(text) && text[i] == '=' {
+			i++
+			for i < len(text) && isSpace(text[i]) {
+				i++
+			}
+			if i < len(text) && (text[i] == '"' || text[i] == '\'') {
+				quote := text[i]
+				i++
+				start := i
+				for i < len(text) && text[i] != quote {
+					i++
+				}
+				value = text[start:i]
+				i++
 			} else {
-				p.node = &model.Node{Type: model.Element, Value: name, Attrs: attrs}
+				start := i
+				for i < len(text) && !isSpace(text[i]) {
+					i++
+				}
+				value = text[start:i]
 			}
-			return
 		}
-		if parent := p.unfinished.Peek(); parent != nil {
-			node := &model.Node{Type: model.Element, Value: name, Parent: parent, Attrs: attrs}
-			p.unfinished.Push(node)
-		} else {
-			node := &model.Node{Type: model.Element, Value: name, Parent: nil, Attrs: attrs}
-			p.unfinished.Push(node)
+		if key == "" {
+			continue
+		}
+		if _, ok := attrs[key]; !ok {
+			attrs[key] = replaceCharReference(value)
 		}
 	}
+	return name, attrs
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func (p *Parser) addComment(text string) {
+	parent := p.unfinished.Peek()
+	parent.Children = append(parent.Children, &model.Node{Type: model.Comment, Value: text, Parent: parent, Pos: p.start})
+}
+
+func (p *Parser) addDoctype(text string) {
+	// a doctype is only meaningful before any element
+	if p.unfinished.Peek() != p.document || hasElement(p.document) {
+		p.report(model.SeverityWarning, "unexpected-doctype", "Unexpected doctype")
+		return
+	}
+	doctype := parseDoctype(text)
+	doctype.Parent = p.document
+	doctype.Pos = p.start
+	p.document.Children = append(p.document.Children, doctype)
+	p.document.Mode = documentMode(doctype)
+}
+
+func hasElement(node *model.Node) bool {
+	for _, child := range node.Children {
+		if child.Type == model.Element {
+			return true
+		}
+	}
+	return false
 }
 
 func (p *Parser) addText(text string) {
-	text = strings.TrimSpace(text)
+	parent := p.unfinished.Peek()
+	if isPreformatted(parent.Value) && len(parent.Children) == 0 {
+		// a newline right after the start tag is ignored
+		text = strings.TrimPrefix(strings.TrimPrefix(text, "\r"), "\n")
+	}
 	if text == "" {
 		return
 	}
-	text = replaceCharReference(text)
-	if parent := p.unfinished.Peek(); parent != nil {
-		parent.Children = append(parent.Children, &model.Node{Type: model.Text, Value: text, Parent: parent})
-	} else {
-		p.node = &model.Node{Type: model.Text, Value: text}
+	if !isRawText(parent.Value) {
+		text = replaceCharReference(text)
 	}
+	parent.Children = append(parent.Children, &model.Node{Type: model.Text, Value: text, Parent: parent, Pos: p.start})
+}
+
+var characterReferences = map[string]string{
+	"&lt;":   "<",
+	"&gt;":   ">",
+	"&amp;":  "&",
+	"&quot;": "\"",
+	"&apos;": "'",
 }
 
+// replaceCharReference decodes the character references of text from left
+// to right, so that the text a reference decodes to is not decoded again.
 func replaceCharReference(text string) string {
-	var characterReferences = map[string]string{
-		"&lt;":   "<",
-		"&gt;":   ">",
-		"&amp;":  "&",
-		"&quot;": "\"",
-		"&apos;": "'",
+	if !strings.Contains(text, "&") {
+		return text
 	}
-	for k, v := range characterReferences {
-		text = strings.ReplaceAll(text, k, v)
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(text, '&')
+		if i < 0 {
+			break
+		}
+		b.WriteString(text[:i])
+		text = text[i:]
+		end := strings.IndexByte(text, ';')
+		if end < 0 {
+			break
+		}
+		if value, ok := characterReferences[text[:end+1]]; ok {
+			b.WriteString(value)
+			text = text[end+1:]
+		} else {
+			b.WriteByte('&')
+			text = text[1:]
+		}
 	}
-	return text
+	b.WriteString(text)
+	return b.String()
+}
+
+func isPreformatted(tag string) bool {
+	return tag == "pre" || tag == "textarea" || tag == "listing"
 }
 
 func isSelefClosingTag(tag string) bool {
@@ -0,0 +1,93 @@
+package html
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pishiko/tenmusu/internal/parser/model"
+)
+
+var (
+	textEscaper = strings.NewReplacer(
+		"&", "&amp;",
+		"<", "&lt;",
+		">", "&gt;",
+	)
+	attrEscaper = strings.NewReplacer(
+		"&", "&amp;",
+		"\"", "&quot;",
+		"<", "&lt;",
+		">", "&gt;",
+	)
+)
+
+// Render writes node and its descendants as HTML markup to w.
+// The output parses back into an equivalent tree with Parse.
+func Render(w io.Writer, node *model.Node) error {
+	bw := bufio.NewWriter(w)
+	render(bw, node)
+	return bw.Flush()
+}
+
+func render(w *bufio.Writer, node *model.Node) {
+	switch node.Type {
+	case model.Document:
+		for _, child := range node.Children {
+			render(w, child)
+		}
+	case model.Doctype:
+		w.WriteString("<!DOCTYPE " + node.Value)
+		publicID, hasPublic := node.Attrs["publicId"]
+		systemID, hasSystem := node.Attrs["systemId"]
+		if hasPublic {
+			w.WriteString(" PUBLIC \"" + publicID + "\"")
+			if hasSystem {
+				w.WriteString(" \"" + systemID + "\"")
+			}
+		} else if hasSystem {
+			w.WriteString(" SYSTEM \"" + systemID + "\"")
+		}
+		w.WriteString(">")
+	case model.Comment:
+		w.WriteString("<!--" + node.Value + "-->")
+	case model.ProcessingInstruction:
+		w.WriteString("<?" + node.Value + "?>")
+	case model.Text:
+		if node.Parent != nil && isRawText(node.Parent.Value) {
+			w.WriteString(node.Value)
+		} else {
+			textEscaper.WriteString(w, node.Value)
+		}
+	case model.Element:
+		w.WriteString("<" + node.Value)
+		keys := make([]string, 0, len(node.Attrs))
+		for key := range node.Attrs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			w.WriteString(" " + key + "=\"")
+			attrEscaper.WriteString(w, node.Attrs[key])
+			w.WriteString("\"")
+		}
+		w.WriteString(">")
+		if isSelefClosingTag(node.Value) {
+			return
+		}
+		// Parse drops a newline right after the start tag, so keep the original one
+		if isPreformatted(node.Value) && len(node.Children) > 0 &&
+			node.Children[0].Type == model.Text && strings.HasPrefix(node.Children[0].Value, "\n") {
+			w.WriteString("\n")
+		}
+		for _, child := range node.Children {
+			render(w, child)
+		}
+		w.WriteString("</" + node.Value + ">")
+	}
+}
+
+func isRawText(tag string) bool {
+	return tag == "script" || tag == "style"
+}
@@ -0,0 +1,72 @@
+package html
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pishiko/tenmusu/internal/parser/model"
+)
+
+// dump writes the tree as one line per node, with what Render must keep.
+func dump(b *strings.Builder, node *model.Node, depth int) {
+	keys := make([]string, 0, len(node.Attrs))
+	for key := range node.Attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(b, "%s%d %q", strings.Repeat("  ", depth), node.Type, node.Value)
+	for _, key := range keys {
+		fmt.Fprintf(b, " %s=%q", key, node.Attrs[key])
+	}
+	b.WriteString("\n")
+	for _, child := range node.Children {
+		dump(b, child, depth+1)
+	}
+}
+
+func TestRenderRoundTrip(t *testing.T) {
+	tests := []string{
+		// raw text
+		`<script>if (a < b && c > d) { s = "</p>"; }</script>`,
+		`<script>x = "<b>&amp;</b>" </scriptx> </script>`,
+		`<style>p > a::before { content: "&lt;" }</style>`,
+		// attributes
+		`<p title="a &quot;quoted&quot; &amp; <b>" class=x data-empty="">text</p>`,
+		`<a href='/path?a=1&amp;b=2'>link</a>`,
+		// void elements
+		`<p>one<br>two<img src="a.png" alt="a"><input type=checkbox checked></p>`,
+		`<head><meta charset="utf-8"><link rel=stylesheet href=a.css></head>`,
+		// text, comments and the doctype
+		`<!DOCTYPE html><p>1 &lt; 2 &amp;&amp; 3 &gt; 2</p><!-- note -->`,
+		`<pre>` + "\n\nindented\n" + `</pre>`,
+	}
+	for _, test := range tests {
+		doc := Parse(test)
+		var rendered strings.Builder
+		if err := Render(&rendered, doc); err != nil {
+			t.Fatalf("Render(%q): %v", test, err)
+		}
+		var want, got strings.Builder
+		dump(&want, doc, 0)
+		dump(&got, Parse(rendered.String()), 0)
+		if got.String() != want.String() {
+			t.Errorf("%q rendered as %q parses to\n%s\nwant\n%s", test, rendered.String(), got.String(), want.String())
+		}
+	}
+}
+
+func TestRawTextEndTag(t *testing.T) {
+	doc := Parse(`<script>a = "</div>" </SCRIPT ><p>after</p>`)
+	scripts := doc.GetElementsByTagName("script")
+	if len(scripts) != 1 || len(scripts[0].Children) != 1 {
+		t.Fatalf("got %d scripts", len(scripts))
+	}
+	if got, want := scripts[0].Children[0].Value, `a = "</div>" `; got != want {
+		t.Errorf("script text = %q, want %q", got, want)
+	}
+	if len(doc.GetElementsByTagName("p")) != 1 {
+		t.Errorf("the element after the script is missing")
+	}
+}
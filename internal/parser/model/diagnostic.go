@@ -0,0 +1,45 @@
+package model
+
+import "strconv"
+
+// Position is a location in a source file. Line and Column are 1-based,
+// and Column counts runes.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	s := p.File
+	if s == "" {
+		s = "<input>"
+	}
+	return s + ":" + strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Column)
+}
+
+type Severity int
+
+const (
+	SeverityWarning Severity = iota
+	SeverityError
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Diagnostic is a problem found while parsing a document or a stylesheet.
+type Diagnostic struct {
+	Severity Severity
+	Code     string
+	Pos      Position
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return d.Pos.String() + ": " + d.Severity.String() + ": " + d.Message + " [" + d.Code + "]"
+}
@@ -0,0 +1,296 @@
+package model
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrNotFound  = errors.New("the node is not a child of this node")
+	ErrHierarchy = errors.New("the node cannot be inserted here")
+)
+
+// Matcher matches nodes. css.Selector implements it.
+type Matcher interface {
+	Matches(node *Node) bool
+}
+
+// walk calls f for each descendant of n in tree order until f returns false.
+func (n *Node) walk(f func(node *Node) bool) bool {
+	for _, child := range n.Children {
+		if !f(child) || !child.walk(f) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetElementByID returns the first descendant element whose id is id, or
+// nil. No element has an empty id.
+func (n *Node) GetElementByID(id string) *Node {
+	if id == "" {
+		return nil
+	}
+	var ret *Node
+	n.walk(func(node *Node) bool {
+		if v, ok := node.Attrs["id"]; ok && node.Type == Element && v == id {
+			ret = node
+			return false
+		}
+		return true
+	})
+	return ret
+}
+
+// GetElementsByTagName returns the descendant elements named name. "*"
+// matches all elements. Names of elements parsed as XML are case-sensitive.
+func (n *Node) GetElementsByTagName(name string) []*Node {
+	lower := strings.ToLower(name)
+	ret := []*Node{}
+	n.walk(func(node *Node) bool {
+		if node.Type != Element {
+			return true
+		}
+		if name == "*" || node.Namespace == "" && node.Value == lower || node.Namespace != "" && node.Value == name {
+			ret = append(ret, node)
+		}
+		return true
+	})
+	return ret
+}
+
+// GetElementsByClassName returns the descendant elements that have all of the
+// space separated classes in names.
+func (n *Node) GetElementsByClassName(names string) []*Node {
+	classes := strings.Fields(names)
+	ret := []*Node{}
+	if len(classes) == 0 {
+		return ret
+	}
+	n.walk(func(node *Node) bool {
+		if node.Type != Element {
+			return true
+		}
+		for _, class := range classes {
+			if !node.HasClass(class) {
+				return true
+			}
+		}
+		ret = append(ret, node)
+		return true
+	})
+	return ret
+}
+
+func (n *Node) HasClass(class string) bool {
+	for _, c := range strings.Fields(n.Attrs["class"]) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// QuerySelector returns the first descendant element matched by selector.
+func (n *Node) QuerySelector(selector Matcher) *Node {
+	var ret *Node
+	n.walk(func(node *Node) bool {
+		if node.Type == Element && selector.Matches(node) {
+			ret = node
+			return false
+		}
+		return true
+	})
+	return ret
+}
+
+// QuerySelectorAll returns the descendant elements matched by selector in tree order.
+func (n *Node) QuerySelectorAll(selector Matcher) []*Node {
+	ret := []*Node{}
+	n.walk(func(node *Node) bool {
+		if node.Type == Element && selector.Matches(node) {
+			ret = append(ret, node)
+		}
+		return true
+	})
+	return ret
+}
+
+// Contains reports whether other is n or a descendant of n.
+func (n *Node) Contains(other *Node) bool {
+	for ; other != nil; other = other.Parent {
+		if other == n {
+			return true
+		}
+	}
+	return false
+}
+
+// numberChildren caches the positions of the children of n, which makes
+// sibling access constant time. Mutations clear the cache, and appends
+// by the parsers change the number of children, which also invalidates it.
+func (n *Node) numberChildren() {
+	elements := 0
+	for i, child := range n.Children {
+		child.index = i
+		child.elementIndex = elements
+		if child.Type == Element {
+			elements++
+		}
+	}
+	n.numbered = len(n.Children)
+	n.elements = elements
+}
+
+func (n *Node) indexOf(child *Node) int {
+	i := child.index
+	if n.numbered != len(n.Children) || i >= len(n.Children) || n.Children[i] != child {
+		n.numberChildren()
+		i = child.index
+	}
+	if i >= len(n.Children) || n.Children[i] != child {
+		return -1
+	}
+	return i
+}
+
+// ElementIndex returns the position of n among the elements of its
+// parent, from 0, and the number of those elements.
+func (n *Node) ElementIndex() (int, int) {
+	if n.Parent == nil || n.Parent.indexOf(n) < 0 {
+		return 0, 1
+	}
+	return n.elementIndex, n.Parent.elements
+}
+
+func (n *Node) PreviousSibling() *Node {
+	if n.Parent == nil {
+		return nil
+	}
+	if i := n.Parent.indexOf(n); i > 0 {
+		return n.Parent.Children[i-1]
+	}
+	return nil
+}
+
+func (n *Node) NextSibling() *Node {
+	if n.Parent == nil {
+		return nil
+	}
+	if i := n.Parent.indexOf(n); i >= 0 && i+1 < len(n.Parent.Children) {
+		return n.Parent.Children[i+1]
+	}
+	return nil
+}
+
+func (n *Node) PreviousElementSibling() *Node {
+	sibling := n.PreviousSibling()
+	for sibling != nil && sibling.Type != Element {
+		sibling = sibling.PreviousSibling()
+	}
+	return sibling
+}
+
+func (n *Node) NextElementSibling() *Node {
+	sibling := n.NextSibling()
+	for sibling != nil && sibling.Type != Element {
+		sibling = sibling.NextSibling()
+	}
+	return sibling
+}
+
+// AppendChild moves child to the end of n's children.
+func (n *Node) AppendChild(child *Node) error {
+	return n.InsertBefore(child, nil)
+}
+
+// InsertBefore moves child just before ref. A nil ref appends child.
+func (n *Node) InsertBefore(child, ref *Node) error {
+	if child.Contains(n) {
+		return ErrHierarchy
+	}
+	if ref != nil && ref.Parent != n {
+		return ErrNotFound
+	}
+	if child == ref {
+		return nil
+	}
+	if child.Parent != nil {
+		child.Parent.RemoveChild(child)
+	}
+	i := len(n.Children)
+	if ref != nil {
+		i = n.indexOf(ref)
+	}
+	n.Children = append(n.Children, nil)
+	copy(n.Children[i+1:], n.Children[i:])
+	n.Children[i] = child
+	n.numbered = -1
+	child.Parent = n
+	return nil
+}
+
+func (n *Node) RemoveChild(child *Node) error {
+	i := n.indexOf(child)
+	if i < 0 {
+		return ErrNotFound
+	}
+	n.Children = append(n.Children[:i], n.Children[i+1:]...)
+	n.numbered = -1
+	child.Parent = nil
+	return nil
+}
+
+// TextContent returns the concatenated text of all descendant text nodes.
+func (n *Node) TextContent() string {
+	switch n.Type {
+	case Text, Comment:
+		return n.Value
+	}
+	var b strings.Builder
+	n.walk(func(node *Node) bool {
+		if node.Type == Text {
+			b.WriteString(node.Value)
+		}
+		return true
+	})
+	return b.String()
+}
+
+// SetTextContent replaces the children of n with a single text node.
+func (n *Node) SetTextContent(text string) {
+	switch n.Type {
+	case Text, Comment:
+		n.Value = text
+		return
+	}
+	for _, child := range n.Children {
+		child.Parent = nil
+	}
+	n.Children = nil
+	n.numbered = -1
+	if text != "" {
+		n.Children = []*Node{{Type: Text, Value: text, Parent: n}}
+	}
+}
+
+func (n *Node) GetAttribute(name string) (string, bool) {
+	value, ok := n.Attrs[strings.ToLower(name)]
+	return value, ok
+}
+
+func (n *Node) HasAttribute(name string) bool {
+	_, ok := n.Attrs[strings.ToLower(name)]
+	return ok
+}
+
+func (n *Node) SetAttribute(name, value string) {
+	if n.Attrs == nil {
+		n.Attrs = make(map[string]string)
+	}
+	n.Attrs[strings.ToLower(name)] = value
+}
+
+func (n *Node) RemoveAttribute(name string) {
+	delete(n.Attrs, strings.ToLower(name))
+}
@@ -0,0 +1,185 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// element builds an element with attributes given as name, value pairs.
+func element(tag string, attrs []string, children ...*Node) *Node {
+	n := &Node{Type: Element, Value: tag, Attrs: map[string]string{}}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		n.Attrs[attrs[i]] = attrs[i+1]
+	}
+	for _, child := range children {
+		child.Parent = n
+		n.Children = append(n.Children, child)
+	}
+	return n
+}
+
+func text(s string) *Node {
+	return &Node{Type: Text, Value: s}
+}
+
+// checkParents fails when a descendant of n is not in the children of its parent.
+func checkParents(t *testing.T, n *Node) {
+	t.Helper()
+	for i, child := range n.Children {
+		if child.Parent != n {
+			t.Errorf("child %d %q of %q has parent %v", i, child.Value, n.Value, child.Parent)
+		}
+		checkParents(t, child)
+	}
+}
+
+// tags returns the names of the children of n, with text as "#".
+func tags(n *Node) string {
+	names := []string{}
+	for _, child := range n.Children {
+		if child.Type == Text {
+			names = append(names, "#")
+		} else {
+			names = append(names, child.Value)
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+func newTree() *Node {
+	return element("div", []string{"id", "root"},
+		element("p", []string{"id", "first", "class", "note big"}, text("one")),
+		text(" "),
+		element("p", nil, text("two"), element("span", []string{"id", "", "class", "note"})),
+		element("ul", []string{"class", "big"}, element("li", []string{"id", "item"})),
+	)
+}
+
+func TestGetElementByID(t *testing.T) {
+	root := newTree()
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"first", "p"},
+		{"item", "li"},
+		{"root", ""}, // only descendants
+		{"missing", ""},
+		{"", ""}, // not the elements without an id, nor the empty one
+	}
+	for _, test := range tests {
+		got := root.GetElementByID(test.id)
+		switch {
+		case test.want == "" && got != nil:
+			t.Errorf("GetElementByID(%q) = <%s>, want nil", test.id, got.Value)
+		case test.want != "" && (got == nil || got.Value != test.want):
+			t.Errorf("GetElementByID(%q) = %v, want <%s>", test.id, got, test.want)
+		}
+	}
+}
+
+func TestGetElementsBy(t *testing.T) {
+	root := newTree()
+	tests := []struct {
+		name string
+		got  []*Node
+		want int
+	}{
+		{"tag p", root.GetElementsByTagName("p"), 2},
+		{"tag P", root.GetElementsByTagName("P"), 2},
+		{"tag *", root.GetElementsByTagName("*"), 5},
+		{"class note", root.GetElementsByClassName("note"), 2},
+		{"class big note", root.GetElementsByClassName(" big  note "), 1},
+		{"no class", root.GetElementsByClassName(" "), 0},
+	}
+	for _, test := range tests {
+		if len(test.got) != test.want {
+			t.Errorf("%s: got %d elements, want %d", test.name, len(test.got), test.want)
+		}
+	}
+}
+
+func TestMutation(t *testing.T) {
+	root := newTree()
+	first := root.GetElementByID("first")
+	list := root.GetElementsByTagName("ul")[0]
+	item := root.GetElementByID("item")
+
+	// moving a node takes it out of its old parent
+	if err := list.AppendChild(first); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tags(root), "# p ul"; got != want {
+		t.Errorf("root children = %q, want %q", got, want)
+	}
+	if got, want := tags(list), "li p"; got != want {
+		t.Errorf("list children = %q, want %q", got, want)
+	}
+	checkParents(t, root)
+
+	if err := list.InsertBefore(first, item); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tags(list), "p li"; got != want {
+		t.Errorf("list children = %q, want %q", got, want)
+	}
+	if first.NextSibling() != item || item.PreviousSibling() != first || item.NextSibling() != nil {
+		t.Errorf("siblings are not updated after InsertBefore")
+	}
+	checkParents(t, root)
+
+	if err := item.AppendChild(root); !errors.Is(err, ErrHierarchy) {
+		t.Errorf("inserting an ancestor: got %v, want ErrHierarchy", err)
+	}
+	if err := root.InsertBefore(text("x"), item); !errors.Is(err, ErrNotFound) {
+		t.Errorf("inserting before a node of another parent: got %v, want ErrNotFound", err)
+	}
+
+	if err := list.RemoveChild(item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Parent != nil || tags(list) != "p" {
+		t.Errorf("RemoveChild left parent %v and children %q", item.Parent, tags(list))
+	}
+	if err := list.RemoveChild(item); !errors.Is(err, ErrNotFound) {
+		t.Errorf("removing a removed node: got %v, want ErrNotFound", err)
+	}
+	checkParents(t, root)
+}
+
+func TestTextContent(t *testing.T) {
+	root := newTree()
+	if got, want := root.TextContent(), "one two"; got != want {
+		t.Errorf("TextContent() = %q, want %q", got, want)
+	}
+	first := root.GetElementByID("first")
+	old := first.Children[0]
+	first.SetTextContent("new")
+	if old.Parent != nil {
+		t.Errorf("the replaced text still has a parent")
+	}
+	if got, want := root.TextContent(), "new two"; got != want {
+		t.Errorf("TextContent() = %q, want %q", got, want)
+	}
+	checkParents(t, root)
+	first.SetTextContent("")
+	if len(first.Children) != 0 {
+		t.Errorf("SetTextContent(\"\") left %d children", len(first.Children))
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	n := &Node{Type: Element, Value: "a"}
+	n.SetAttribute("HREF", "/x")
+	if v, ok := n.GetAttribute("href"); !ok || v != "/x" {
+		t.Errorf("GetAttribute(href) = %q, %v", v, ok)
+	}
+	if !n.HasAttribute("Href") {
+		t.Errorf("HasAttribute(Href) = false")
+	}
+	n.RemoveAttribute("href")
+	if n.HasAttribute("href") {
+		t.Errorf("the attribute is not removed")
+	}
+}
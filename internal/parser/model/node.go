@@ -5,6 +5,30 @@ type NodeType int
 const (
 	Text NodeType = iota
 	Element
+	Comment
+	Doctype
+	Document
+	ProcessingInstruction
+)
+
+// DocumentMode is the compatibility mode of a document, decided from its doctype.
+type DocumentMode int
+
+const (
+	NoQuirksMode DocumentMode = iota
+	QuirksMode
+	LimitedQuirksMode
+)
+
+// ElementState is the set of dynamic states of an element, used by
+// pseudo-classes like :hover.
+type ElementState int
+
+const (
+	StateHover ElementState = 1 << iota
+	StateActive
+	StateFocus
+	StateVisited
 )
 
 type Node struct {
@@ -14,4 +38,28 @@ type Node struct {
 	Parent   *Node
 	Attrs    map[string]string
 	Style    map[string]string
+	Computed ComputedStyle
+	Pos      Position
+	State    ElementState
+
+	// Pseudo is the name of the pseudo-element, like "before", of a box
+	// generated for Parent. Such boxes are not in the children of Parent.
+	Pseudo string
+	// Before and After are the boxes generated by ::before and ::after,
+	// set when the style is computed, or nil when there is no content.
+	Before, After *Node
+	// Marker is the ::marker box of a list item, or nil.
+	Marker *Node
+
+	// Namespace is the namespace URI of an element parsed as XML.
+	// It is empty for elements parsed as HTML.
+	Namespace string
+
+	// Document only
+	Mode DocumentMode
+
+	// positions of the node among its siblings, cached by Parent.numberChildren
+	index, elementIndex int
+	// number of children and child elements when their positions were cached, or -1
+	numbered, elements int
 }
@@ -0,0 +1,39 @@
+package model
+
+// ComputedStyle is the typed form of the computed values in Style, so
+// that layout does not parse them again. Lengths are in pixels.
+type ComputedStyle struct {
+	FontSize   float64
+	FontWeight int
+	// Lengths are the properties taking a length, a percentage or auto,
+	// like width and margin-top.
+	Lengths map[string]Length
+	// ViewportRelative is set when some of the values are in vw, vh, vmin
+	// or vmax, so that they change with the size of the window.
+	ViewportRelative bool
+}
+
+// Length is a computed <length-percentage> or auto. Percentages stay
+// unresolved until layout, where the size they refer to is known.
+type Length struct {
+	Auto    bool
+	Px      float64
+	Percent float64
+	// Calc resolves a math function mixing lengths and percentages in a
+	// way that is not a plain sum, like min(50%, 200px). Px and Percent
+	// are not used when it is set.
+	Calc func(base float64) float64
+}
+
+// Resolve returns the length in pixels, with percentages of base.
+func (l Length) Resolve(base float64) float64 {
+	if l.Calc != nil {
+		return l.Calc(base)
+	}
+	return l.Px + l.Percent*base/100
+}
+
+// UsesPercentage reports whether the length depends on the size percentages refer to.
+func (l Length) UsesPercentage() bool {
+	return l.Calc != nil || l.Percent != 0
+}
@@ -0,0 +1,187 @@
+package xml
+
+import (
+	encxml "encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pishiko/tenmusu/internal/parser/html"
+	"github.com/pishiko/tenmusu/internal/parser/model"
+)
+
+const (
+	NamespaceXHTML = "http://www.w3.org/1999/xhtml"
+	NamespaceSVG   = "http://www.w3.org/2000/svg"
+	NamespaceXLink = "http://www.w3.org/1999/xlink"
+	NamespaceXML   = "http://www.w3.org/XML/1998/namespace"
+)
+
+var attrPrefixes = map[string]string{
+	"xmlns":        "xmlns",
+	NamespaceXLink: "xlink",
+	NamespaceXML:   "xml",
+}
+
+// IsXMLType reports whether a Content-Type asks for the XML parser.
+func IsXMLType(contentType string) bool {
+	mimeType, _, _ := strings.Cut(contentType, ";")
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	switch mimeType {
+	case "application/xml", "text/xml":
+		return true
+	}
+	return strings.HasSuffix(mimeType, "+xml")
+}
+
+// Parse parses an XML document such as XHTML or SVG. Element names keep
+// their case and their namespace URI is set to Node.Namespace.
+// When the document is not well-formed, the returned tree is an error page
+// describing the first error, as browsers show it.
+func Parse(body string, file string) (*model.Node, []model.Diagnostic) {
+	document := &model.Node{Type: model.Document, Value: "#document", Mode: model.NoQuirksMode}
+	decoder := encxml.NewDecoder(strings.NewReader(body))
+	decoder.Strict = true
+	decoder.Entity = encxml.HTMLEntity
+
+	current := document
+	line, column := 1, 1
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			if current != document {
+				err = errors.New("no element found")
+			} else if !hasElement(document) {
+				err = errors.New("no root element found")
+			} else {
+				break
+			}
+		}
+		if err != nil {
+			line, column = decoder.InputPos()
+			diagnostic := model.Diagnostic{
+				Severity: model.SeverityError,
+				Code:     "xml-not-well-formed",
+				Pos:      model.Position{File: file, Line: line, Column: column},
+				Message:  errorMessage(err),
+			}
+			return errorPage(body, diagnostic), []model.Diagnostic{diagnostic}
+		}
+
+		pos := model.Position{File: file, Line: line, Column: column}
+		switch t := token.(type) {
+		case encxml.StartElement:
+			node := &model.Node{
+				Type:      model.Element,
+				Value:     t.Name.Local,
+				Namespace: t.Name.Space,
+				Parent:    current,
+				Attrs:     map[string]string{},
+				Pos:       pos,
+			}
+			// declarations first, so that the other attributes can find their prefix
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" || attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+					node.Attrs[attrName(node, attr.Name)] = attr.Value
+				}
+			}
+			for _, attr := range t.Attr {
+				node.Attrs[attrName(node, attr.Name)] = attr.Value
+			}
+			current.Children = append(current.Children, node)
+			current = node
+		case encxml.EndElement:
+			current = current.Parent
+		case encxml.CharData:
+			if current == document {
+				// whitespace outside of the root element
+				break
+			}
+			current.Children = append(current.Children, &model.Node{Type: model.Text, Value: string(t), Parent: current, Pos: pos})
+		case encxml.Comment:
+			current.Children = append(current.Children, &model.Node{Type: model.Comment, Value: string(t), Parent: current, Pos: pos})
+		case encxml.ProcInst:
+			if t.Target == "xml" {
+				// XML declaration
+				break
+			}
+			value := t.Target
+			if len(t.Inst) > 0 {
+				value += " " + string(t.Inst)
+			}
+			current.Children = append(current.Children, &model.Node{Type: model.ProcessingInstruction, Value: value, Parent: current, Pos: pos})
+		case encxml.Directive:
+			directive := strings.TrimSpace(string(t))
+			if len(directive) >= 7 && strings.EqualFold(directive[:7], "DOCTYPE") {
+				name, _, _ := strings.Cut(strings.TrimSpace(directive[7:]), " ")
+				document.Children = append(document.Children, &model.Node{Type: model.Doctype, Value: name, Parent: document, Attrs: map[string]string{}, Pos: pos})
+			}
+		}
+		line, column = decoder.InputPos()
+	}
+	return document, nil
+}
+
+// attrName returns the qualified name of an attribute of node, with the
+// prefix its namespace is declared with in node or its ancestors.
+func attrName(node *model.Node, name encxml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	if prefix, ok := attrPrefixes[name.Space]; ok {
+		return prefix + ":" + name.Local
+	}
+	for n := node; n != nil; n = n.Parent {
+		// the first in order, when several prefixes are declared for the namespace
+		prefix := ""
+		for key, value := range n.Attrs {
+			if p, ok := strings.CutPrefix(key, "xmlns:"); ok && value == name.Space && (prefix == "" || p < prefix) {
+				prefix = p
+			}
+		}
+		if prefix != "" {
+			return prefix + ":" + name.Local
+		}
+	}
+	// an undeclared prefix is left in place of the namespace
+	return name.Space + ":" + name.Local
+}
+
+func hasElement(node *model.Node) bool {
+	for _, child := range node.Children {
+		if child.Type == model.Element {
+			return true
+		}
+	}
+	return false
+}
+
+func errorMessage(err error) string {
+	var syntaxErr *encxml.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return syntaxErr.Msg
+	}
+	return err.Error()
+}
+
+var escaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// errorPage builds the document shown instead of a broken XML document.
+func errorPage(body string, d model.Diagnostic) *model.Node {
+	lines := strings.Split(body, "\n")
+	source := ""
+	if d.Pos.Line-1 < len(lines) {
+		source = strings.TrimRight(lines[d.Pos.Line-1], "\r")
+	}
+	caret := strings.Repeat("-", max(d.Pos.Column-1, 0)) + "^"
+
+	var b strings.Builder
+	b.WriteString("<html><body><parsererror>")
+	b.WriteString("<h1>XML Parsing Error: " + escaper.Replace(d.Message) + "</h1>")
+	b.WriteString("<p>Location: " + escaper.Replace(d.Pos.File) + "</p>")
+	b.WriteString("<p>Line Number " + strconv.Itoa(d.Pos.Line) + ", Column " + strconv.Itoa(d.Pos.Column) + ":</p>")
+	b.WriteString("<pre>" + escaper.Replace(source) + "\n" + caret + "</pre>")
+	b.WriteString("</parsererror></body></html>")
+	return html.Parse(b.String())
+}
@@ -0,0 +1,102 @@
+package xml
+
+import (
+	"strings"
+	"testing"
+)
+
+const svgDocument = `<?xml version="1.0"?>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" xmlns:ex="http://example.com/ns" viewBox="0 0 10 10">
+  <foreignObject width="10"><div xmlns="http://www.w3.org/1999/xhtml"/></foreignObject>
+  <use xlink:href="#a" ex:data="1" xml:lang="en"/>
+  <text><![CDATA[a < b]]> &amp; c</text>
+</svg>`
+
+func TestParse(t *testing.T) {
+	doc, diagnostics := Parse(svgDocument, "test.svg")
+	if len(diagnostics) != 0 {
+		t.Fatalf("diagnostics = %v", diagnostics)
+	}
+	svg := doc.Children[0]
+	if svg.Value != "svg" || svg.Namespace != NamespaceSVG {
+		t.Errorf("root = <%s> in %q", svg.Value, svg.Namespace)
+	}
+	if svg.Attrs["viewBox"] != "0 0 10 10" {
+		t.Errorf("viewBox = %q, want its case kept", svg.Attrs["viewBox"])
+	}
+
+	foreign := doc.GetElementsByTagName("foreignObject")
+	if len(foreign) != 1 {
+		t.Fatalf("found %d foreignObject", len(foreign))
+	}
+	div := foreign[0].Children[0]
+	if div.Value != "div" || div.Namespace != NamespaceXHTML || len(div.Children) != 0 {
+		t.Errorf("self-closing div = <%s> in %q with %d children", div.Value, div.Namespace, len(div.Children))
+	}
+
+	use := doc.GetElementsByTagName("use")[0]
+	for name, want := range map[string]string{"xlink:href": "#a", "ex:data": "1", "xml:lang": "en"} {
+		if got, ok := use.Attrs[name]; !ok || got != want {
+			t.Errorf("%s = %q, %v, want %q", name, got, ok, want)
+		}
+	}
+
+	text := doc.GetElementsByTagName("text")[0]
+	if got, want := text.TextContent(), "a < b & c"; got != want {
+		t.Errorf("text = %q, want %q", got, want)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		body         string
+		line, column int
+	}{
+		{"<root>\n  <a></b>\n</root>", 2, 10},
+		{"<root>", 1, 7},
+		{"", 1, 1},
+	}
+	for _, test := range tests {
+		doc, diagnostics := Parse(test.body, "test.xml")
+		if len(diagnostics) != 1 {
+			t.Errorf("%q: got %d diagnostics, want 1", test.body, len(diagnostics))
+			continue
+		}
+		d := diagnostics[0]
+		if d.Code != "xml-not-well-formed" || d.Pos.Line != test.line || d.Pos.Column != test.column {
+			t.Errorf("%q: diagnostic %v, want line %d column %d", test.body, d, test.line, test.column)
+		}
+		// the error page shows the message, the location and the line
+		errors := doc.GetElementsByTagName("parsererror")
+		if len(errors) != 1 {
+			t.Errorf("%q: no parsererror in the error page", test.body)
+			continue
+		}
+		page := errors[0].TextContent()
+		for _, want := range []string{"XML Parsing Error: " + d.Message, "test.xml", "Line Number"} {
+			if !strings.Contains(page, want) {
+				t.Errorf("%q: error page %q does not contain %q", test.body, page, want)
+			}
+		}
+		if pre := errors[0].GetElementsByTagName("pre"); len(pre) != 1 || !strings.HasSuffix(pre[0].TextContent(), "^") {
+			t.Errorf("%q: error page does not point at the column", test.body)
+		}
+	}
+}
+
+func TestIsXMLType(t *testing.T) {
+	tests := map[string]bool{
+		"application/xhtml+xml":        true,
+		"image/svg+xml; charset=utf-8": true,
+		"text/xml":                     true,
+		"Application/XML":              true,
+		"text/html":                    false,
+		"text/html; charset=utf-8":     false,
+		"":                             false,
+	}
+	for contentType, want := range tests {
+		if got := IsXMLType(contentType); got != want {
+			t.Errorf("IsXMLType(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
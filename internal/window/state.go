@@ -0,0 +1,106 @@
+package window
+
+import (
+	"github.com/pishiko/tenmusu/internal/parser/model"
+)
+
+// elementState tracks the elements matched by :hover, :active and :focus.
+type elementState struct {
+	hovered *model.Node
+	active  *model.Node
+	focused *model.Node
+}
+
+// updateState updates the dynamic states of elements from the mouse, and
+// restyles the document when any of them changed.
+func (b *Window) updateState(pressed bool) {
+	var target *model.Node
+	if b.layout != nil {
+		target = b.layout.HitTest(float64(b.cursor.x), float64(b.cursor.y-b.scrollY))
+	}
+
+	changed := moveState(&b.state.hovered, target, model.StateHover, true)
+
+	// a link is followed when the button is released over the link it was pressed on
+	var followed *model.Node
+	if !pressed && b.clicked {
+		if link := hyperlink(target); link != nil && link == hyperlink(b.state.active) {
+			followed = link
+		}
+	}
+
+	// an element stays active while the button is held, even if the cursor leaves it
+	active := b.state.active
+	if !pressed {
+		active = nil
+	} else if !b.clicked {
+		active = target
+		changed = moveState(&b.state.focused, focusable(target), model.StateFocus, false) || changed
+	}
+	changed = moveState(&b.state.active, active, model.StateActive, true) || changed
+
+	if changed && b.Restyle != nil {
+		b.Restyle()
+	}
+	if followed != nil && b.FollowLink != nil {
+		b.FollowLink(followed)
+	}
+}
+
+// moveState moves flag from the element in *current to next, and their
+// ancestors when inherited is set. It reports whether anything changed.
+func moveState(current **model.Node, next *model.Node, flag model.ElementState, inherited bool) bool {
+	if *current == next {
+		return false
+	}
+	for node := *current; node != nil; node = node.Parent {
+		node.State &^= flag
+		if !inherited {
+			break
+		}
+	}
+	for node := next; node != nil; node = node.Parent {
+		node.State |= flag
+		if !inherited {
+			break
+		}
+	}
+	*current = next
+	return true
+}
+
+// hyperlink returns the nearest ancestor of node that is a link with an href.
+func hyperlink(node *model.Node) *model.Node {
+	for ; node != nil; node = node.Parent {
+		if node.Type != model.Element || node.Value != "a" && node.Value != "area" {
+			continue
+		}
+		if _, ok := node.Attrs["href"]; ok {
+			return node
+		}
+	}
+	return nil
+}
+
+// focusable returns the nearest ancestor of node that can take focus.
+func focusable(node *model.Node) *model.Node {
+	for ; node != nil; node = node.Parent {
+		if node.Type != model.Element {
+			continue
+		}
+		if _, ok := node.Attrs["tabindex"]; ok {
+			return node
+		}
+		switch node.Value {
+		case "a", "area":
+			if _, ok := node.Attrs["href"]; ok {
+				return node
+			}
+		case "input", "button", "select", "textarea":
+			if _, ok := node.Attrs["disabled"]; !ok {
+				return node
+			}
+		}
+	}
+	return nil
+}
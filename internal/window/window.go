@@ -4,6 +4,7 @@ import (
 	_ "embed"
 	"fmt"
 	"image/color"
+	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
@@ -18,6 +19,55 @@ type Window struct {
 	cursor  struct {
 		x, y int
 	}
+	refresh struct {
+		pending bool
+		at      time.Time
+		url     string
+	}
+	layout *layout.DocumentLayout
+	state  elementState
+	size   struct {
+		width, height int
+		changed       bool
+	}
+	tasks chan func()
+
+	// Navigate is called when the document asks to go to another URL.
+	Navigate func(url string)
+	// FollowLink is called when a link with an href is clicked.
+	FollowLink func(link *model.Node)
+	// Restyle is called when the state of elements changed and styles must be recomputed.
+	Restyle func()
+	// Resize is called when the size of the window changed.
+	Resize func(width, height int)
+}
+
+// DefaultWidth and DefaultHeight are the size of the window when it opens.
+const (
+	DefaultWidth  = 800
+	DefaultHeight = 600
+)
+
+// SetDocument replaces the document shown in the window.
+func (b *Window) SetDocument(node *model.Node) {
+	b.node = node
+	b.scrollY = 0
+	b.refresh.pending = false
+	b.layout = nil
+	b.state = elementState{}
+}
+
+// RunOnUpdate runs f in the next Update, where it can change the document
+// safely. It is meant for goroutines, and blocks until then.
+func (b *Window) RunOnUpdate(f func()) {
+	b.tasks <- f
+}
+
+// ScheduleRefresh navigates to url once delay has passed.
+func (b *Window) ScheduleRefresh(delay time.Duration, url string) {
+	b.refresh.pending = true
+	b.refresh.at = time.Now().Add(delay)
+	b.refresh.url = url
 }
 
 func (b *Window) Update() error {
@@ -25,9 +75,34 @@ func (b *Window) Update() error {
 		return ebiten.Termination
 	}
 
+	for pending := true; pending; {
+		select {
+		case f := <-b.tasks:
+			f()
+		default:
+			pending = false
+		}
+	}
+
+	if b.refresh.pending && !time.Now().Before(b.refresh.at) {
+		b.refresh.pending = false
+		if b.Navigate != nil {
+			b.Navigate(b.refresh.url)
+		}
+	}
+
+	if b.size.changed {
+		b.size.changed = false
+		if b.Resize != nil {
+			b.Resize(b.size.width, b.size.height)
+		}
+	}
+
 	mx, my := ebiten.CursorPosition()
 	b.cursor.x, b.cursor.y = mx, my
-	b.clicked = ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft)
+	pressed := ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft)
+	b.updateState(pressed)
+	b.clicked = pressed
 
 	if ebiten.IsKeyPressed(ebiten.KeyUp) {
 		b.scrollY += 5
@@ -43,27 +118,35 @@ func (b *Window) Draw(screen *ebiten.Image) {
 
 	l := layout.NewDocumentLayout(b.node, screen.Bounds())
 	drawables := l.Layout()
+	b.layout = l
 	for _, drawable := range drawables {
 		drawable.Draw(screen, float64(b.scrollY))
 	}
 
 }
 func (b *Window) Layout(outsideWidth, outsideHeight int) (int, int) {
+	if outsideWidth != b.size.width || outsideHeight != b.size.height {
+		b.size.width, b.size.height = outsideWidth, outsideHeight
+		b.size.changed = true
+	}
 	return outsideWidth, outsideHeight
 }
 
 func NewWindow(node *model.Node) *Window {
-	return &Window{
+	w := &Window{
 		node:    node,
 		scrollY: 0,
+		tasks:   make(chan func()),
 	}
+	w.size.width, w.size.height = DefaultWidth, DefaultHeight
+	return w
 }
 
-func Open(node *model.Node) {
-	ebiten.SetWindowSize(800, 600)
+func Open(w *Window) {
+	ebiten.SetWindowSize(DefaultWidth, DefaultHeight)
 	ebiten.SetWindowTitle("tenmusu")
 	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
-	if err := ebiten.RunGame(NewWindow(node)); err != nil {
+	if err := ebiten.RunGame(w); err != nil {
 		panic(err)
 	}
 	println("Exiting...")